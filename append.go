@@ -0,0 +1,192 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// minPartSize is the smallest size S3 accepts for every part but the last
+const minPartSize = s3manager.MinUploadPartSize
+
+// AppendToObject appends data to the object at bucket/key, creating it if
+// it does not exist. The existing content is reused with UploadPartCopy when
+// it is large enough to be a multipart part; smaller objects are read back
+// and re-uploaded together with the new data. The object is only replaced
+// if it was not modified concurrently, otherwise the append fails with a
+// PreconditionFailed error and can be retried.
+func AppendToObject(ctx context.Context, sess *session.Session, bucket, key string, data io.Reader) (*UploadResult, error) {
+	svc := s3.New(sess)
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if err = wrapError(err); !errors.Is(err, ErrObjectNotFound) {
+			return nil, err
+		}
+		head = nil
+	}
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	condition := map[string]string{"If-None-Match": "*"}
+	var size int64
+	if head != nil {
+		size = aws.Int64Value(head.ContentLength)
+		condition = map[string]string{"If-Match": aws.StringValue(head.ETag)}
+		create.ContentType = head.ContentType
+		create.ContentEncoding = head.ContentEncoding
+		create.ContentDisposition = head.ContentDisposition
+		create.CacheControl = head.CacheControl
+		create.Metadata = head.Metadata
+		create.StorageClass = head.StorageClass
+	}
+
+	mpu, err := svc.CreateMultipartUploadWithContext(ctx, create)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	a := &appender{ctx: ctx, svc: svc, bucket: bucket, key: key, uploadID: mpu.UploadId}
+	result, err := a.run(head, size, data, condition)
+	if err != nil {
+		svc.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: mpu.UploadId,
+		})
+		return nil, err
+	}
+	return result, nil
+}
+
+// appender assembles the parts of a single append
+type appender struct {
+	ctx      context.Context
+	svc      *s3.S3
+	bucket   string
+	key      string
+	uploadID *string
+	parts    []*s3.CompletedPart
+}
+
+func (a *appender) run(head *s3.HeadObjectOutput, size int64, data io.Reader, condition map[string]string) (*UploadResult, error) {
+	var pending []byte
+	switch {
+	case head == nil:
+	case size >= minPartSize:
+		if err := a.copyExisting(aws.StringValue(head.ETag), size); err != nil {
+			return nil, err
+		}
+	default:
+		// Too small to be a non-final part, so it is uploaded again
+		existing, err := a.svc.GetObjectWithContext(a.ctx, &s3.GetObjectInput{
+			Bucket:  aws.String(a.bucket),
+			Key:     aws.String(a.key),
+			IfMatch: head.ETag,
+		})
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		pending, err = io.ReadAll(existing.Body)
+		existing.Body.Close()
+		if err != nil {
+			return nil, wrapError(err)
+		}
+	}
+
+	buf := make([]byte, minPartSize)
+	for {
+		// pending never holds a full part here, so read until it does
+		n, err := io.ReadFull(data, buf[:int(minPartSize)-len(pending)])
+		pending = append(pending, buf[:n]...)
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return nil, err
+		}
+		if len(pending) == int(minPartSize) || (eof && (len(pending) > 0 || len(a.parts) == 0)) {
+			if err := a.uploadPart(pending); err != nil {
+				return nil, err
+			}
+			pending = pending[:0]
+		}
+		if eof {
+			break
+		}
+	}
+
+	out, err := a.svc.CompleteMultipartUploadWithContext(a.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(a.bucket),
+		Key:             aws.String(a.key),
+		UploadId:        a.uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: a.parts},
+	}, request.WithSetRequestHeaders(condition))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return &UploadResult{
+		Bucket:    a.bucket,
+		Key:       a.key,
+		Location:  aws.StringValue(out.Location),
+		VersionID: aws.StringValue(out.VersionId),
+		ETag:      aws.StringValue(out.ETag),
+	}, nil
+}
+
+// copyExisting adds the current object content as the leading parts. Objects
+// above the CopyObject limit are split into equal ranges so that every range
+// stays above the minimum part size.
+func (a *appender) copyExisting(etag string, size int64) error {
+	ranges := (size + maxCopyObjectSize - 1) / maxCopyObjectSize
+	step := (size + ranges - 1) / ranges
+	for off := int64(0); off < size; off += step {
+		end := off + step - 1
+		if end >= size {
+			end = size - 1
+		}
+		out, err := a.svc.UploadPartCopyWithContext(a.ctx, &s3.UploadPartCopyInput{
+			Bucket:            aws.String(a.bucket),
+			Key:               aws.String(a.key),
+			UploadId:          a.uploadID,
+			PartNumber:        aws.Int64(int64(len(a.parts) + 1)),
+			CopySource:        aws.String(copySource(a.bucket, a.key)),
+			CopySourceRange:   aws.String(fmt.Sprintf("bytes=%d-%d", off, end)),
+			CopySourceIfMatch: aws.String(etag),
+		})
+		if err != nil {
+			return wrapError(err)
+		}
+		a.parts = append(a.parts, &s3.CompletedPart{
+			PartNumber: aws.Int64(int64(len(a.parts) + 1)),
+			ETag:       out.CopyPartResult.ETag,
+		})
+	}
+	return nil
+}
+
+// uploadPart uploads data as the next part
+func (a *appender) uploadPart(data []byte) error {
+	n := aws.Int64(int64(len(a.parts) + 1))
+	out, err := a.svc.UploadPartWithContext(a.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(a.bucket),
+		Key:        aws.String(a.key),
+		UploadId:   a.uploadID,
+		PartNumber: n,
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	a.parts = append(a.parts, &s3.CompletedPart{PartNumber: n, ETag: out.ETag})
+	return nil
+}
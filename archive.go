@@ -0,0 +1,221 @@
+package s3utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ArchivePrefixToS3 streams every regular file under localDir into a single
+// tar.gz object at bucket/key. The archive is produced while it is uploaded,
+// so neither it nor the files are held in memory.
+func ArchivePrefixToS3(ctx context.Context, sess *session.Session, localDir, bucket, key string, opts ...UploadOption) (*UploadResult, error) {
+	files, err := walkLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTarGz(pw, files, names))
+	}()
+
+	cfg := newUploadConfig(bucket, key, pr, opts)
+	if cfg.input.ContentType == nil {
+		cfg.input.ContentType = aws.String("application/gzip")
+	}
+	return cfg.upload(ctx, sess)
+}
+
+// writeTarGz writes the named files as a gzip-compressed tar stream to w
+func writeTarGz(w io.Writer, files map[string]localFile, names []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		f := files[name]
+		hdr, err := tar.FileInfoHeader(f.info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ExtractArchiveFromS3 stream-extracts the tar or zip object at bucket/key
+// into localDir and returns the number of files written. Tar archives may be
+// compressed with any registered codec. Entries that would land outside
+// localDir are rejected. Nothing is extracted when localDir lacks the free
+// space for the uncompressed zip entries, or for at least the size of a tar
+// object; an *InsufficientSpaceError is returned instead.
+func ExtractArchiveFromS3(ctx context.Context, sess *session.Session, bucket, key, localDir string) (int, error) {
+	preflight := func(size int64) error {
+		return CheckDiskSpace(localDir, size)
+	}
+	return walkArchive(ctx, sess, bucket, key, preflight, func(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+		target := filepath.Join(localDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0o600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, r); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, modTime, modTime)
+	})
+}
+
+// ExtractArchiveToS3 stream-extracts the tar or zip object at bucket/key into
+// individual objects under dstBucket/dstPrefix and returns the number of
+// objects written
+func ExtractArchiveToS3(ctx context.Context, sess *session.Session, bucket, key, dstBucket, dstPrefix string, opts ...UploadOption) (int, error) {
+	return walkArchive(ctx, sess, bucket, key, nil, func(name string, mode os.FileMode, modTime time.Time, r io.Reader) error {
+		cfg := newUploadConfig(dstBucket, JoinKey(dstPrefix, name), r, opts)
+		_, err := cfg.upload(ctx, sess)
+		return err
+	})
+}
+
+// archiveEntryFunc receives each regular file of an archive
+type archiveEntryFunc func(name string, mode os.FileMode, modTime time.Time, r io.Reader) error
+
+// walkArchive calls fn for every regular file in the archive at bucket/key.
+// A non-nil preflight is first given the estimated size of the extracted files.
+func walkArchive(ctx context.Context, sess *session.Session, bucket, key string, preflight func(size int64) error, fn archiveEntryFunc) (int, error) {
+	svc := s3.New(sess)
+	if strings.HasSuffix(strings.ToLower(key), ".zip") {
+		return walkZip(ctx, svc, bucket, key, preflight, fn)
+	}
+
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	defer out.Body.Close()
+	if preflight != nil {
+		// Compressed tar streams do not record their extracted size
+		if err := preflight(aws.Int64Value(out.ContentLength)); err != nil {
+			return 0, err
+		}
+	}
+	r, err := decompressReader(key, out, out.Body)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	n := 0
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, wrapError(err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return n, fmt.Errorf("s3utils: archive entry %q escapes the destination", hdr.Name)
+		}
+		if err := fn(path.Clean(hdr.Name), hdr.FileInfo().Mode(), hdr.ModTime, tr); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// walkZip calls fn for every regular file of a zip object. The central
+// directory is at the end of a zip, so the object is read with ranged GETs
+// instead of a single stream.
+func walkZip(ctx context.Context, svc *s3.S3, bucket, key string, preflight func(size int64) error, fn archiveEntryFunc) (int, error) {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, wrapError(err)
+	}
+	ra := &objectReaderAt{ctx: ctx, svc: svc, bucket: bucket, key: key, etag: aws.StringValue(head.ETag)}
+	zr, err := zip.NewReader(ra, aws.Int64Value(head.ContentLength))
+	if err != nil {
+		return 0, err
+	}
+	if preflight != nil {
+		var size int64
+		for _, f := range zr.File {
+			if f.Mode().IsRegular() {
+				size += int64(f.UncompressedSize64)
+			}
+		}
+		if err := preflight(size); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		if !filepath.IsLocal(f.Name) {
+			return n, fmt.Errorf("s3utils: archive entry %q escapes the destination", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return n, err
+		}
+		err = fn(path.Clean(f.Name), f.Mode(), f.Modified, rc)
+		rc.Close()
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
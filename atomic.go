@@ -0,0 +1,163 @@
+package s3utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// TempDirName is the sub-prefix UploadAtomic writes in-flight objects to
+const TempDirName = ".tmp"
+
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// checksum returns the base64 checksum S3 reports for parts == 0, and
+// otherwise the composite checksum, which is empty when the content does
+// not split into that many parts
+func (h *partHasher) checksum(parts int) string {
+	sum := h.sum(parts)
+	if sum == nil {
+		return ""
+	}
+	if parts == 0 {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return base64.StdEncoding.EncodeToString(sum) + "-" + strconv.Itoa(parts)
+}
+
+// UploadAtomic uploads a file to <dir of key>/.tmp/<uuid>, verifies its
+// SHA-256 checksum against the bytes sent, then server-side copies it to key
+// and deletes the temporary object. Readers of key never observe a partially
+// written object.
+func UploadAtomic(ctx context.Context, sess *session.Session, fileName, bucket, key string, opts ...UploadOption) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tmpKey := JoinKey(path.Dir(key), TempDirName, newUUID())
+	cfg := newUploadConfig(bucket, key, file, opts)
+	finalKey := aws.StringValue(cfg.input.Key)
+	cfg.input.Key = aws.String(tmpKey)
+	cfg.input.ChecksumAlgorithm = aws.String(s3.ChecksumAlgorithmSha256)
+	cfg.sent = newPartHasher(0, sha256.New)
+	// The receipt must describe the final object, not the temporary one
+	receipt := cfg.receipt
+	cfg.receipt = nil
+
+	if _, err := cfg.upload(ctx, sess); err != nil {
+		return err
+	}
+
+	svc := s3.New(sess)
+	cleanup := func() {
+		svc.DeleteObjectWithContext(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(tmpKey),
+		})
+	}
+
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(tmpKey),
+		ChecksumMode:         aws.String(s3.ChecksumModeEnabled),
+		SSECustomerAlgorithm: cfg.input.SSECustomerAlgorithm,
+		SSECustomerKey:       cfg.input.SSECustomerKey,
+		SSECustomerKeyMD5:    cfg.input.SSECustomerKeyMD5,
+	})
+	if err != nil {
+		cleanup()
+		return wrapError(err)
+	}
+	remote := aws.StringValue(head.ChecksumSHA256)
+	parts := 0
+	if i := strings.LastIndexByte(remote, '-'); i >= 0 {
+		parts, _ = strconv.Atoi(remote[i+1:])
+	}
+	if local := cfg.sent.checksum(parts); local != remote {
+		cleanup()
+		return fmt.Errorf("s3utils: checksum mismatch for %s: local %s, uploaded %s", finalKey, local, remote)
+	}
+
+	err = copyObject(ctx, svc, bucket, tmpKey, promoteInput(cfg.input, finalKey))
+	cleanup()
+	if err != nil || receipt == nil {
+		return err
+	}
+
+	final, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(finalKey),
+		SSECustomerAlgorithm: cfg.input.SSECustomerAlgorithm,
+		SSECustomerKey:       cfg.input.SSECustomerKey,
+		SSECustomerKeyMD5:    cfg.input.SSECustomerKeyMD5,
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	sum, err := fileSHA256Hex(fileName)
+	if err != nil {
+		return err
+	}
+	_, err = receipt.write(ctx, sess, &UploadResult{
+		Bucket:    bucket,
+		Key:       finalKey,
+		VersionID: aws.StringValue(final.VersionId),
+		ETag:      aws.StringValue(final.ETag),
+	}, sum)
+	return err
+}
+
+// promoteInput builds the copy of the temporary object uploaded with in to
+// finalKey. The copy does not inherit the storage class, object lock,
+// encryption, ACL or tags of its source, so they are set again from in.
+func promoteInput(in *s3manager.UploadInput, finalKey string) *s3.CopyObjectInput {
+	copyIn := &s3.CopyObjectInput{
+		Bucket:                         in.Bucket,
+		Key:                            aws.String(finalKey),
+		ChecksumAlgorithm:              aws.String(s3.ChecksumAlgorithmSha256),
+		ACL:                            in.ACL,
+		BucketKeyEnabled:               in.BucketKeyEnabled,
+		ExpectedBucketOwner:            in.ExpectedBucketOwner,
+		ObjectLockLegalHoldStatus:      in.ObjectLockLegalHoldStatus,
+		ObjectLockMode:                 in.ObjectLockMode,
+		ObjectLockRetainUntilDate:      in.ObjectLockRetainUntilDate,
+		RequestPayer:                   in.RequestPayer,
+		SSECustomerAlgorithm:           in.SSECustomerAlgorithm,
+		SSECustomerKey:                 in.SSECustomerKey,
+		SSECustomerKeyMD5:              in.SSECustomerKeyMD5,
+		CopySourceSSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		CopySourceSSECustomerKey:       in.SSECustomerKey,
+		CopySourceSSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+		SSEKMSEncryptionContext:        in.SSEKMSEncryptionContext,
+		SSEKMSKeyId:                    in.SSEKMSKeyId,
+		ServerSideEncryption:           in.ServerSideEncryption,
+		StorageClass:                   in.StorageClass,
+	}
+	if in.Tagging != nil {
+		copyIn.Tagging = in.Tagging
+		copyIn.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+	}
+	return copyIn
+}
@@ -0,0 +1,68 @@
+package s3utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func TestPromoteInput(t *testing.T) {
+	key := bytes.Repeat([]byte{'k'}, 32)
+	retainUntil := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg := newUploadConfig("bkt", "dir/file.bin", bytes.NewReader(nil), []UploadOption{
+		WithStorageClass(s3.StorageClassStandardIa),
+		WithObjectLock(s3.ObjectLockModeCompliance, retainUntil),
+		WithLegalHold(),
+		WithSSECustomerKey(key),
+		WithUploadInput(func(in *s3manager.UploadInput) {
+			in.ACL = aws.String(s3.ObjectCannedACLBucketOwnerFullControl)
+			in.Tagging = aws.String("a=b")
+		}),
+	})
+	got := promoteInput(cfg.input, "dir/file.bin")
+
+	tests := []struct {
+		field     string
+		got, want string
+	}{
+		{"Bucket", aws.StringValue(got.Bucket), "bkt"},
+		{"Key", aws.StringValue(got.Key), "dir/file.bin"},
+		{"ChecksumAlgorithm", aws.StringValue(got.ChecksumAlgorithm), s3.ChecksumAlgorithmSha256},
+		{"StorageClass", aws.StringValue(got.StorageClass), s3.StorageClassStandardIa},
+		{"ObjectLockMode", aws.StringValue(got.ObjectLockMode), s3.ObjectLockModeCompliance},
+		{"ObjectLockRetainUntilDate", aws.TimeValue(got.ObjectLockRetainUntilDate).String(), retainUntil.String()},
+		{"ObjectLockLegalHoldStatus", aws.StringValue(got.ObjectLockLegalHoldStatus), s3.ObjectLockLegalHoldStatusOn},
+		{"ACL", aws.StringValue(got.ACL), s3.ObjectCannedACLBucketOwnerFullControl},
+		{"Tagging", aws.StringValue(got.Tagging), "a=b"},
+		{"TaggingDirective", aws.StringValue(got.TaggingDirective), s3.TaggingDirectiveReplace},
+		{"SSECustomerAlgorithm", aws.StringValue(got.SSECustomerAlgorithm), "AES256"},
+		{"SSECustomerKey", aws.StringValue(got.SSECustomerKey), string(key)},
+		{"CopySourceSSECustomerAlgorithm", aws.StringValue(got.CopySourceSSECustomerAlgorithm), "AES256"},
+		{"CopySourceSSECustomerKey", aws.StringValue(got.CopySourceSSECustomerKey), string(key)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestPromoteInputKMS(t *testing.T) {
+	cfg := newUploadConfig("bkt", "file.bin", bytes.NewReader(nil), []UploadOption{
+		WithUploadInput(func(in *s3manager.UploadInput) {
+			in.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+			in.SSEKMSKeyId = aws.String("alias/data")
+		}),
+	})
+	got := promoteInput(cfg.input, "file.bin")
+	if aws.StringValue(got.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms || aws.StringValue(got.SSEKMSKeyId) != "alias/data" {
+		t.Errorf("encryption = %q %q, want KMS alias/data", aws.StringValue(got.ServerSideEncryption), aws.StringValue(got.SSEKMSKeyId))
+	}
+	if got.TaggingDirective != nil || got.CopySourceSSECustomerKey != nil {
+		t.Errorf("untagged, unencrypted upload set TaggingDirective %v, CopySourceSSECustomerKey %v", got.TaggingDirective, got.CopySourceSSECustomerKey)
+	}
+}
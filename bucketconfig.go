@@ -0,0 +1,416 @@
+package s3utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// BucketConfig is the desired configuration of a bucket. Nil fields are
+// left unmanaged; empty non-nil values (an empty slice, map or policy)
+// remove the setting from the bucket.
+type BucketConfig struct {
+	Versioning *bool             `json:"versioning,omitempty"`
+	Encryption *BucketEncryption `json:"encryption,omitempty"`
+	Lifecycle  []LifecycleRule   `json:"lifecycle,omitempty"`
+	CORS       []CORSRule        `json:"cors,omitempty"`
+	Policy     *string           `json:"policy,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// BucketEncryption is the default server-side encryption of a bucket
+type BucketEncryption struct {
+	// Algorithm is AES256 or aws:kms
+	Algorithm        string `json:"algorithm"`
+	KMSKeyID         string `json:"kms_key_id,omitempty"`
+	BucketKeyEnabled bool   `json:"bucket_key_enabled,omitempty"`
+}
+
+// CORSRule is a bucket CORS rule
+type CORSRule struct {
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+	ExposeHeaders  []string `json:"expose_headers,omitempty"`
+	MaxAgeSeconds  int64    `json:"max_age_seconds,omitempty"`
+}
+
+// BucketChange is a single difference between the live and desired configuration
+type BucketChange struct {
+	Setting string
+	// Action is "create", "update" or "delete"
+	Action string
+	From   string
+	To     string
+
+	apply func(ctx context.Context, svc *s3.S3) error
+}
+
+// BucketPlan lists the changes Apply will make to converge a bucket
+type BucketPlan struct {
+	Bucket  string
+	Changes []BucketChange
+}
+
+// Empty reports whether the bucket already matches the desired configuration
+func (p *BucketPlan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String renders the plan in a human-readable diff format
+func (p *BucketPlan) String() string {
+	if p.Empty() {
+		return fmt.Sprintf("bucket %s: no changes\n", p.Bucket)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "bucket %s: %d change(s)\n", p.Bucket, len(p.Changes))
+	for _, c := range p.Changes {
+		switch c.Action {
+		case "create":
+			fmt.Fprintf(&b, "  + %s: %s\n", c.Setting, c.To)
+		case "delete":
+			fmt.Fprintf(&b, "  - %s: %s\n", c.Setting, c.From)
+		default:
+			fmt.Fprintf(&b, "  ~ %s: %s -> %s\n", c.Setting, c.From, c.To)
+		}
+	}
+	return b.String()
+}
+
+// bucketSetting compares and converges one managed setting
+type bucketSetting struct {
+	name    string
+	live    func(ctx context.Context, svc *s3.S3, bucket string) (string, error)
+	desired string
+	put     func(ctx context.Context, svc *s3.S3, bucket string) error
+	delete  func(ctx context.Context, svc *s3.S3, bucket string) error
+}
+
+// PlanBucketConfig compares the live configuration of bucket with desired
+func PlanBucketConfig(ctx context.Context, sess *session.Session, bucket string, desired BucketConfig) (*BucketPlan, error) {
+	svc := s3.New(sess)
+	plan := &BucketPlan{Bucket: bucket}
+
+	for _, s := range bucketSettings(desired) {
+		live, err := s.live(ctx, svc, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("s3utils: read %s of %s: %w", s.name, bucket, err)
+		}
+		if live == s.desired {
+			continue
+		}
+
+		s := s
+		change := BucketChange{Setting: s.name, From: live, To: s.desired}
+		switch {
+		case s.desired == "":
+			change.Action = "delete"
+			change.apply = func(ctx context.Context, svc *s3.S3) error { return s.delete(ctx, svc, bucket) }
+		case live == "":
+			change.Action = "create"
+			change.apply = func(ctx context.Context, svc *s3.S3) error { return s.put(ctx, svc, bucket) }
+		default:
+			change.Action = "update"
+			change.apply = func(ctx context.Context, svc *s3.S3) error { return s.put(ctx, svc, bucket) }
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	return plan, nil
+}
+
+// ApplyBucketPlan executes the changes of a plan created by PlanBucketConfig
+func ApplyBucketPlan(ctx context.Context, sess *session.Session, plan *BucketPlan) error {
+	svc := s3.New(sess)
+	for _, c := range plan.Changes {
+		if err := c.apply(ctx, svc); err != nil {
+			return fmt.Errorf("s3utils: %s %s of %s: %w", c.Action, c.Setting, plan.Bucket, err)
+		}
+	}
+	return nil
+}
+
+// ApplyBucketConfig plans and applies desired in one step and returns the executed plan
+func ApplyBucketConfig(ctx context.Context, sess *session.Session, bucket string, desired BucketConfig) (*BucketPlan, error) {
+	plan, err := PlanBucketConfig(ctx, sess, bucket, desired)
+	if err != nil {
+		return nil, err
+	}
+	return plan, ApplyBucketPlan(ctx, sess, plan)
+}
+
+// canonical renders v as deterministic JSON used to compare settings
+func canonical(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// ignoreCodes turns the "not configured" errors of a getter into an empty result
+func ignoreCodes(err error, codes ...string) error {
+	for _, code := range codes {
+		if isAWSErrorCode(err, code) {
+			return nil
+		}
+	}
+	return wrapError(err)
+}
+
+func bucketSettings(cfg BucketConfig) []bucketSetting {
+	var settings []bucketSetting
+
+	if cfg.Versioning != nil {
+		desired := "Suspended"
+		if *cfg.Versioning {
+			desired = "Enabled"
+		}
+		settings = append(settings, bucketSetting{
+			name:    "versioning",
+			desired: desired,
+			live: func(ctx context.Context, svc *s3.S3, bucket string) (string, error) {
+				out, err := svc.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+				if err != nil {
+					return "", wrapError(err)
+				}
+				status := aws.StringValue(out.Status)
+				if status == "" {
+					// Never-versioned buckets behave like suspended ones
+					status = "Suspended"
+				}
+				return status, nil
+			},
+			put: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.PutBucketVersioningWithContext(ctx, &s3.PutBucketVersioningInput{
+					Bucket:                  aws.String(bucket),
+					VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(desired)},
+				})
+				return wrapError(err)
+			},
+		})
+	}
+
+	if cfg.Encryption != nil {
+		enc := *cfg.Encryption
+		desired := ""
+		if enc.Algorithm != "" {
+			desired = canonical(enc)
+		}
+		settings = append(settings, bucketSetting{
+			name:    "encryption",
+			desired: desired,
+			live: func(ctx context.Context, svc *s3.S3, bucket string) (string, error) {
+				out, err := svc.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+				if err != nil {
+					return "", ignoreCodes(err, "ServerSideEncryptionConfigurationNotFoundError")
+				}
+				for _, r := range out.ServerSideEncryptionConfiguration.Rules {
+					if d := r.ApplyServerSideEncryptionByDefault; d != nil {
+						return canonical(BucketEncryption{
+							Algorithm:        aws.StringValue(d.SSEAlgorithm),
+							KMSKeyID:         aws.StringValue(d.KMSMasterKeyID),
+							BucketKeyEnabled: aws.BoolValue(r.BucketKeyEnabled),
+						}), nil
+					}
+				}
+				return "", nil
+			},
+			put: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				def := &s3.ServerSideEncryptionByDefault{SSEAlgorithm: aws.String(enc.Algorithm)}
+				if enc.KMSKeyID != "" {
+					def.KMSMasterKeyID = aws.String(enc.KMSKeyID)
+				}
+				_, err := svc.PutBucketEncryptionWithContext(ctx, &s3.PutBucketEncryptionInput{
+					Bucket: aws.String(bucket),
+					ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+						Rules: []*s3.ServerSideEncryptionRule{{
+							ApplyServerSideEncryptionByDefault: def,
+							BucketKeyEnabled:                   aws.Bool(enc.BucketKeyEnabled),
+						}},
+					},
+				})
+				return wrapError(err)
+			},
+			delete: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.DeleteBucketEncryptionWithContext(ctx, &s3.DeleteBucketEncryptionInput{Bucket: aws.String(bucket)})
+				return wrapError(err)
+			},
+		})
+	}
+
+	if cfg.Lifecycle != nil {
+		rules := cfg.Lifecycle
+		desired := ""
+		if len(rules) > 0 {
+			desired = canonical(rules)
+		}
+		settings = append(settings, bucketSetting{
+			name:    "lifecycle",
+			desired: desired,
+			live: func(ctx context.Context, svc *s3.S3, bucket string) (string, error) {
+				live, err := getLifecycleRules(ctx, svc, bucket)
+				if err != nil || len(live) == 0 {
+					return "", err
+				}
+				return canonical(live), nil
+			},
+			put: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				return putLifecycleRules(ctx, svc, bucket, rules)
+			},
+			delete: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)})
+				return wrapError(err)
+			},
+		})
+	}
+
+	if cfg.CORS != nil {
+		rules := cfg.CORS
+		desired := ""
+		if len(rules) > 0 {
+			desired = canonical(rules)
+		}
+		settings = append(settings, bucketSetting{
+			name:    "cors",
+			desired: desired,
+			live: func(ctx context.Context, svc *s3.S3, bucket string) (string, error) {
+				out, err := svc.GetBucketCorsWithContext(ctx, &s3.GetBucketCorsInput{Bucket: aws.String(bucket)})
+				if err != nil {
+					return "", ignoreCodes(err, "NoSuchCORSConfiguration")
+				}
+				var live []CORSRule
+				for _, r := range out.CORSRules {
+					live = append(live, CORSRule{
+						AllowedOrigins: aws.StringValueSlice(r.AllowedOrigins),
+						AllowedMethods: aws.StringValueSlice(r.AllowedMethods),
+						AllowedHeaders: aws.StringValueSlice(r.AllowedHeaders),
+						ExposeHeaders:  aws.StringValueSlice(r.ExposeHeaders),
+						MaxAgeSeconds:  aws.Int64Value(r.MaxAgeSeconds),
+					})
+				}
+				if len(live) == 0 {
+					return "", nil
+				}
+				return canonical(live), nil
+			},
+			put: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				var sdkRules []*s3.CORSRule
+				for _, r := range rules {
+					rule := &s3.CORSRule{
+						AllowedOrigins: aws.StringSlice(r.AllowedOrigins),
+						AllowedMethods: aws.StringSlice(r.AllowedMethods),
+					}
+					if len(r.AllowedHeaders) > 0 {
+						rule.AllowedHeaders = aws.StringSlice(r.AllowedHeaders)
+					}
+					if len(r.ExposeHeaders) > 0 {
+						rule.ExposeHeaders = aws.StringSlice(r.ExposeHeaders)
+					}
+					if r.MaxAgeSeconds > 0 {
+						rule.MaxAgeSeconds = aws.Int64(r.MaxAgeSeconds)
+					}
+					sdkRules = append(sdkRules, rule)
+				}
+				_, err := svc.PutBucketCorsWithContext(ctx, &s3.PutBucketCorsInput{
+					Bucket:            aws.String(bucket),
+					CORSConfiguration: &s3.CORSConfiguration{CORSRules: sdkRules},
+				})
+				return wrapError(err)
+			},
+			delete: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.DeleteBucketCorsWithContext(ctx, &s3.DeleteBucketCorsInput{Bucket: aws.String(bucket)})
+				return wrapError(err)
+			},
+		})
+	}
+
+	if cfg.Policy != nil {
+		policy := *cfg.Policy
+		settings = append(settings, bucketSetting{
+			name:    "policy",
+			desired: canonicalPolicy(policy),
+			live: func(ctx context.Context, svc *s3.S3, bucket string) (string, error) {
+				out, err := svc.GetBucketPolicyWithContext(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+				if err != nil {
+					return "", ignoreCodes(err, "NoSuchBucketPolicy")
+				}
+				return canonicalPolicy(aws.StringValue(out.Policy)), nil
+			},
+			put: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.PutBucketPolicyWithContext(ctx, &s3.PutBucketPolicyInput{
+					Bucket: aws.String(bucket),
+					Policy: aws.String(policy),
+				})
+				return wrapError(err)
+			},
+			delete: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.DeleteBucketPolicyWithContext(ctx, &s3.DeleteBucketPolicyInput{Bucket: aws.String(bucket)})
+				return wrapError(err)
+			},
+		})
+	}
+
+	if cfg.Tags != nil {
+		tags := cfg.Tags
+		desired := ""
+		if len(tags) > 0 {
+			desired = canonical(tags)
+		}
+		settings = append(settings, bucketSetting{
+			name:    "tags",
+			desired: desired,
+			live: func(ctx context.Context, svc *s3.S3, bucket string) (string, error) {
+				out, err := svc.GetBucketTaggingWithContext(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+				if err != nil {
+					return "", ignoreCodes(err, "NoSuchTagSet")
+				}
+				live := make(map[string]string)
+				for _, t := range out.TagSet {
+					live[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+				}
+				if len(live) == 0 {
+					return "", nil
+				}
+				return canonical(live), nil
+			},
+			put: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				keys := make([]string, 0, len(tags))
+				for k := range tags {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				var set []*s3.Tag
+				for _, k := range keys {
+					set = append(set, &s3.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+				}
+				_, err := svc.PutBucketTaggingWithContext(ctx, &s3.PutBucketTaggingInput{
+					Bucket:  aws.String(bucket),
+					Tagging: &s3.Tagging{TagSet: set},
+				})
+				return wrapError(err)
+			},
+			delete: func(ctx context.Context, svc *s3.S3, bucket string) error {
+				_, err := svc.DeleteBucketTaggingWithContext(ctx, &s3.DeleteBucketTaggingInput{Bucket: aws.String(bucket)})
+				return wrapError(err)
+			},
+		})
+	}
+
+	return settings
+}
+
+// canonicalPolicy normalizes a JSON policy document so formatting differences
+// do not show up as changes
+func canonicalPolicy(policy string) string {
+	if strings.TrimSpace(policy) == "" {
+		return ""
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return policy
+	}
+	return canonical(doc)
+}
@@ -0,0 +1,253 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// BucketFS presents the objects under a bucket prefix as a read-only
+// fs.FS, so they can be served with http.FileServer, parsed as templates or
+// passed to anything else that accepts an fs.FS. Slashes in keys become
+// directories; directories have no modification time. fs.FS methods take
+// no context, so every request uses the context given to NewBucketFS.
+type BucketFS struct {
+	ctx    context.Context
+	svc    *s3.S3
+	bucket string
+	prefix string
+}
+
+var (
+	_ fs.ReadDirFS = (*BucketFS)(nil)
+	_ fs.StatFS    = (*BucketFS)(nil)
+)
+
+// NewBucketFS returns a file system rooted at bucket/prefix
+func NewBucketFS(ctx context.Context, sess *session.Session, bucket, prefix string) *BucketFS {
+	return &BucketFS{ctx: ctx, svc: s3.New(sess), bucket: bucket, prefix: strings.Trim(prefix, "/")}
+}
+
+// key returns the object key of name
+func (f *BucketFS) key(name string) string {
+	if name == "." {
+		return f.prefix
+	}
+	return JoinKey(f.prefix, name)
+}
+
+// dirPrefix returns the listing prefix of the directory name
+func (f *BucketFS) dirPrefix(name string) string {
+	if key := f.key(name); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+// Open opens the object or directory name
+func (f *BucketFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		head, err := f.head(name)
+		if err == nil {
+			return &bucketFile{
+				ObjectReader: newObjectReader(f.ctx, f.svc, f.bucket, f.key(name), head),
+				info:         objectFileInfo(name, head),
+			}, nil
+		}
+		if !errors.Is(err, ErrObjectNotFound) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if err := f.checkDir("open", name); err != nil {
+		return nil, err
+	}
+	return &bucketDir{fs: f, name: name}, nil
+}
+
+// Stat returns the file info of the object or directory name
+func (f *BucketFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		head, err := f.head(name)
+		if err == nil {
+			return objectFileInfo(name, head), nil
+		}
+		if !errors.Is(err, ErrObjectNotFound) {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+	}
+	if err := f.checkDir("stat", name); err != nil {
+		return nil, err
+	}
+	return dirFileInfo(name), nil
+}
+
+// ReadDir lists the directory name sorted by file name
+func (f *BucketFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	prefix := f.dirPrefix(name)
+	var entries []fs.DirEntry
+	err := f.svc.ListObjectsV2PagesWithContext(f.ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(f.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, p := range page.CommonPrefixes {
+			dir := strings.TrimSuffix(strings.TrimPrefix(aws.StringValue(p.Prefix), prefix), "/")
+			entries = append(entries, fs.FileInfoToDirEntry(dirFileInfo(dir)))
+		}
+		for _, obj := range page.Contents {
+			base := strings.TrimPrefix(aws.StringValue(obj.Key), prefix)
+			if base == "" {
+				// A zero-byte folder marker for the directory itself
+				continue
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(&bucketFileInfo{
+				name:    base,
+				size:    aws.Int64Value(obj.Size),
+				modTime: aws.TimeValue(obj.LastModified),
+			}))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: wrapError(err)}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (f *BucketFS) head(name string) (*s3.HeadObjectOutput, error) {
+	head, err := f.svc.HeadObjectWithContext(f.ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(f.bucket),
+		Key:    aws.String(f.key(name)),
+	})
+	return head, wrapError(err)
+}
+
+// checkDir reports fs.ErrNotExist unless some object lies under the directory name.
+// The root always exists.
+func (f *BucketFS) checkDir(op, name string) error {
+	if name == "." {
+		return nil
+	}
+	out, err := f.svc.ListObjectsV2WithContext(f.ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(f.bucket),
+		Prefix:  aws.String(f.dirPrefix(name)),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: wrapError(err)}
+	}
+	if len(out.Contents) == 0 {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+// bucketFileInfo describes an object or directory of a BucketFS
+type bucketFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func objectFileInfo(name string, head *s3.HeadObjectOutput) *bucketFileInfo {
+	return &bucketFileInfo{
+		name:    path.Base(name),
+		size:    aws.Int64Value(head.ContentLength),
+		modTime: aws.TimeValue(head.LastModified),
+	}
+}
+
+func dirFileInfo(name string) *bucketFileInfo {
+	return &bucketFileInfo{name: path.Base(name), dir: true}
+}
+
+func (i *bucketFileInfo) Name() string       { return i.name }
+func (i *bucketFileInfo) Size() int64        { return i.size }
+func (i *bucketFileInfo) ModTime() time.Time { return i.modTime }
+func (i *bucketFileInfo) IsDir() bool        { return i.dir }
+func (i *bucketFileInfo) Sys() interface{}   { return nil }
+
+func (i *bucketFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// bucketFile is an open object. Reads and seeks go through ranged GETs.
+type bucketFile struct {
+	*ObjectReader
+	info *bucketFileInfo
+}
+
+func (f *bucketFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// bucketDir is an open directory; its entries are listed on the first ReadDir
+type bucketDir struct {
+	fs      *BucketFS
+	name    string
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (d *bucketDir) Stat() (fs.FileInfo, error) {
+	return dirFileInfo(d.name), nil
+}
+
+func (d *bucketDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *bucketDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries, or all remaining entries when n <= 0
+func (d *bucketDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.loaded = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
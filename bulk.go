@@ -0,0 +1,193 @@
+package s3utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// TransferTask is one upload or download of a bulk operation. Plan
+// functions return tasks without starting any goroutines, so callers can
+// run them under their own errgroup, semaphore or worker pool:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.SetLimit(8)
+//	for _, t := range tasks {
+//		g.Go(t.Func(ctx))
+//	}
+//	err := g.Wait()
+type TransferTask struct {
+	Bucket    string
+	Key       string
+	LocalPath string
+	// Size is the size of the local file for uploads and of the object for downloads
+	Size int64
+	// Result is set once an upload task succeeds. It is nil for downloads.
+	Result *UploadResult
+
+	run func(ctx context.Context, t *TransferTask) error
+}
+
+// Run performs the transfer
+func (t *TransferTask) Run(ctx context.Context) error {
+	return t.run(ctx, t)
+}
+
+// Func returns Run bound to ctx, in the form accepted by errgroup.Group.Go
+func (t *TransferTask) Func(ctx context.Context) func() error {
+	return func() error {
+		return t.run(ctx, t)
+	}
+}
+
+// RunTasks runs tasks with up to concurrency workers, stopping at the first
+// error. Zero uses DefaultConcurrency.
+func RunTasks(ctx context.Context, tasks []*TransferTask, concurrency int) error {
+	return runParallel(ctx, concurrency, tasks, func(ctx context.Context, t *TransferTask) error {
+		return t.Run(ctx)
+	})
+}
+
+// PlanUploadMany returns one task per file uploading it to folder/<base name>.
+// Every key is validated before any task is returned.
+func PlanUploadMany(sess *session.Session, bucket, folder string, files []string, opts ...UploadOption) ([]*TransferTask, error) {
+	tasks := make([]*TransferTask, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		key := JoinKey(folder, filepath.Base(file))
+		if err := ValidateKey(key); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, uploadTask(sess, file, bucket, key, info.Size(), opts, nil))
+	}
+	return tasks, nil
+}
+
+// UploadMany uploads files to folder/<base name> with up to concurrency
+// workers and returns the results in the order of files
+func UploadMany(ctx context.Context, sess *session.Session, bucket, folder string, files []string, concurrency int, opts ...UploadOption) ([]*UploadResult, error) {
+	tasks, err := PlanUploadMany(sess, bucket, folder, files, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := RunTasks(ctx, tasks, concurrency); err != nil {
+		return nil, err
+	}
+	results := make([]*UploadResult, len(tasks))
+	for i, t := range tasks {
+		results[i] = t.Result
+	}
+	return results, nil
+}
+
+// PlanDownloadPrefix lists bucket/prefix and returns one task per object
+// downloading it below localDir at its path relative to prefix, mapped to a
+// file name with DefaultLocalPathRules. Tasks are ordered by key. Keys that
+// differ only in case fail with a *CaseConflictError when localDir is on a
+// case-insensitive file system, and an *InsufficientSpaceError is returned
+// when it cannot hold the objects.
+func PlanDownloadPrefix(ctx context.Context, sess *session.Session, bucket, prefix, localDir string) ([]*TransferTask, error) {
+	remote, err := listRemote(ctx, sess, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := DefaultLocalPathRules.localPaths(remote)
+	if err != nil {
+		return nil, err
+	}
+	insensitive, err := CaseDetect.insensitive(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if insensitive {
+		if err := resolveCaseConflicts(remote, paths, nil); err != nil {
+			return nil, err
+		}
+	}
+	rels := make([]string, 0, len(remote))
+	for rel := range remote {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	tasks := make([]*TransferTask, 0, len(rels))
+	var required int64
+	for _, rel := range rels {
+		dst := DefaultLocalPathRules.LocalPath(localDir, paths[rel])
+		tasks = append(tasks, downloadTask(sess, bucket, dst, remote[rel], nil))
+		required += remote[rel].Size
+	}
+	if err := CheckDiskSpace(localDir, required); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// DownloadPrefix downloads every object under bucket/prefix below localDir
+// with up to concurrency workers and returns the local paths written
+func DownloadPrefix(ctx context.Context, sess *session.Session, bucket, prefix, localDir string, concurrency int) ([]string, error) {
+	tasks, err := PlanDownloadPrefix(ctx, sess, bucket, prefix, localDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := RunTasks(ctx, tasks, concurrency); err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(tasks))
+	for i, t := range tasks {
+		paths[i] = t.LocalPath
+	}
+	return paths, nil
+}
+
+// uploadTask uploads file to bucket/key, calling done after success
+func uploadTask(sess *session.Session, file, bucket, key string, size int64, opts []UploadOption, done func(*TransferTask)) *TransferTask {
+	return &TransferTask{
+		Bucket:    bucket,
+		Key:       key,
+		LocalPath: file,
+		Size:      size,
+		run: func(ctx context.Context, t *TransferTask) error {
+			res, err := uploadFileToKey(ctx, sess, t.LocalPath, t.Bucket, t.Key, opts...)
+			if err != nil {
+				return err
+			}
+			t.Result = res
+			if done != nil {
+				done(t)
+			}
+			return nil
+		},
+	}
+}
+
+// downloadTask downloads obj to localPath and gives the file the object's
+// modification time, calling done after success
+func downloadTask(sess *session.Session, bucket, localPath string, obj ObjectInfo, done func(*TransferTask)) *TransferTask {
+	return &TransferTask{
+		Bucket:    bucket,
+		Key:       obj.Key,
+		LocalPath: localPath,
+		Size:      obj.Size,
+		run: func(ctx context.Context, t *TransferTask) error {
+			if err := os.MkdirAll(filepath.Dir(t.LocalPath), 0o755); err != nil {
+				return err
+			}
+			if err := DownloadFile(ctx, sess, t.Bucket, t.Key, t.LocalPath); err != nil {
+				return err
+			}
+			if err := os.Chtimes(t.LocalPath, obj.LastModified, obj.LastModified); err != nil {
+				return err
+			}
+			if done != nil {
+				done(t)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,185 @@
+package s3utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// existenceCache remembers HeadObject results for a limited time
+type existenceCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// warmed holds bucket/prefix pairs whose full listing is cached, making
+	// misses under them authoritative until they expire
+	warmed map[string]time.Time
+}
+
+type cacheEntry struct {
+	exists  bool
+	expires time.Time
+}
+
+func newExistenceCache(ttl time.Duration) *existenceCache {
+	return &existenceCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		warmed:  make(map[string]time.Time),
+	}
+}
+
+func cacheKey(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// get returns the cached result for bucket/key and whether it was known
+func (c *existenceCache) get(bucket, key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := c.entries[cacheKey(bucket, key)]; ok {
+		if now.Before(e.expires) {
+			return e.exists, true
+		}
+		delete(c.entries, cacheKey(bucket, key))
+	}
+	for p, expires := range c.warmed {
+		if !now.Before(expires) {
+			delete(c.warmed, p)
+			continue
+		}
+		if strings.HasPrefix(cacheKey(bucket, key), p) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func (c *existenceCache) set(bucket, key string, exists bool) {
+	c.setUntil(bucket, key, exists, time.Now().Add(c.ttl))
+}
+
+func (c *existenceCache) setUntil(bucket, key string, exists bool, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(bucket, key)] = cacheEntry{exists: exists, expires: expires}
+}
+
+func (c *existenceCache) invalidate(bucket, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, cacheKey(bucket, key))
+	for p := range c.warmed {
+		if strings.HasPrefix(cacheKey(bucket, key), p) {
+			delete(c.warmed, p)
+		}
+	}
+}
+
+// WithExistenceCache caches existence checks made through the client for ttl.
+// Writes and deletes made through the client's session update the cache.
+// Cached negatives can be stale if other writers create keys, so keep the
+// TTL short and call InvalidateExists after writing through other paths.
+func WithExistenceCache(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.cache = newExistenceCache(ttl)
+		c.sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+			Name: "s3utils.ExistenceCacheUpdate",
+			Fn:   c.cache.observe,
+		})
+	}
+}
+
+// observe records the keys written or deleted by a completed request
+func (c *existenceCache) observe(r *request.Request) {
+	if r.ClientInfo.ServiceName != s3.ServiceName {
+		return
+	}
+	bucket := getStringParam(r.Params, "Bucket")
+	switch r.Operation.Name {
+	case "PutObject", "CompleteMultipartUpload", "CopyObject":
+		key := getStringParam(r.Params, "Key")
+		if r.Error != nil {
+			// A failed write may still have landed
+			c.invalidate(bucket, key)
+			return
+		}
+		c.set(bucket, key, true)
+	case "DeleteObject":
+		c.invalidate(bucket, getStringParam(r.Params, "Key"))
+	case "DeleteObjects":
+		if in, ok := r.Params.(*s3.DeleteObjectsInput); ok && in.Delete != nil {
+			for _, obj := range in.Delete.Objects {
+				c.invalidate(bucket, aws.StringValue(obj.Key))
+			}
+		}
+	}
+}
+
+// Exists checks if a key exists, consulting the existence cache when enabled
+func (c *Client) Exists(ctx context.Context, bucket, key string) (bool, error) {
+	if c.cache != nil {
+		if exists, ok := c.cache.get(bucket, key); ok {
+			return exists, nil
+		}
+	}
+	exists, err := objectExists(ctx, c.svc, bucket, key, "")
+	if err != nil {
+		return false, err
+	}
+	if c.cache != nil {
+		c.cache.set(bucket, key, exists)
+	}
+	return exists, nil
+}
+
+// InvalidateExists drops any cached existence result for bucket/key
+func (c *Client) InvalidateExists(bucket, key string) {
+	if c.cache != nil {
+		c.cache.invalidate(bucket, key)
+	}
+}
+
+// WarmExistenceCache lists prefix once and caches every key found. Until the
+// TTL expires, keys under prefix that were not listed are reported missing
+// without a request.
+func (c *Client) WarmExistenceCache(ctx context.Context, bucket, prefix string) error {
+	if c.cache == nil {
+		return nil
+	}
+	// The listed keys and the prefix expire together, so a listed key is
+	// never reported missing by the prefix after its own entry expired
+	expires := time.Now().Add(c.cache.ttl)
+	err := WalkObjects(ctx, c.sess, bucket, prefix, func(obj ObjectInfo) bool {
+		c.cache.setUntil(bucket, obj.Key, true, expires)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	c.cache.mu.Lock()
+	c.cache.warmed[cacheKey(bucket, prefix)] = expires
+	c.cache.mu.Unlock()
+	return nil
+}
+
+// GenerateUniqueFileName generates a unique file name using the client's existence cache
+func (c *Client) GenerateUniqueFileName(ctx context.Context, bucket, folder, baseName string) (string, error) {
+	return c.GenerateUniqueFileNameWithOptions(ctx, bucket, folder, baseName, UniqueNameOptions{})
+}
+
+// GenerateUniqueFileNameWithOptions generates a unique file name with a
+// configurable format and attempt limit using the client's existence cache
+func (c *Client) GenerateUniqueFileNameWithOptions(ctx context.Context, bucket, folder, baseName string, opts UniqueNameOptions) (string, error) {
+	return generateUniqueFileName(folder, baseName, opts, func(key string) (bool, error) {
+		return c.Exists(ctx, bucket, key)
+	})
+}
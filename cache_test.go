@@ -0,0 +1,171 @@
+package s3utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestExistenceCacheGet(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name       string
+		entries    map[string]cacheEntry
+		warmed     map[string]time.Time
+		key        string
+		wantExists bool
+		wantKnown  bool
+	}{
+		{
+			name: "unknown",
+			key:  "a.txt",
+		},
+		{
+			name:       "cached hit",
+			entries:    map[string]cacheEntry{"b/a.txt": {exists: true, expires: future}},
+			key:        "a.txt",
+			wantExists: true,
+			wantKnown:  true,
+		},
+		{
+			name:      "cached miss",
+			entries:   map[string]cacheEntry{"b/a.txt": {exists: false, expires: future}},
+			key:       "a.txt",
+			wantKnown: true,
+		},
+		{
+			name:    "expired entry",
+			entries: map[string]cacheEntry{"b/a.txt": {exists: true, expires: past}},
+			key:     "a.txt",
+		},
+		{
+			name:      "miss under warmed prefix",
+			warmed:    map[string]time.Time{"b/dir/": future},
+			key:       "dir/a.txt",
+			wantKnown: true,
+		},
+		{
+			name:   "expired warmed prefix",
+			warmed: map[string]time.Time{"b/dir/": past},
+			key:    "dir/a.txt",
+		},
+		{
+			name:       "listed key under warmed prefix",
+			entries:    map[string]cacheEntry{"b/dir/a.txt": {exists: true, expires: future}},
+			warmed:     map[string]time.Time{"b/dir/": future},
+			key:        "dir/a.txt",
+			wantExists: true,
+			wantKnown:  true,
+		},
+		{
+			name:    "listed key and prefix expired together",
+			entries: map[string]cacheEntry{"b/dir/a.txt": {exists: true, expires: past}},
+			warmed:  map[string]time.Time{"b/dir/": past},
+			key:     "dir/a.txt",
+		},
+		{
+			name:   "outside warmed prefix",
+			warmed: map[string]time.Time{"b/dir/": future},
+			key:    "other/a.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newExistenceCache(time.Minute)
+			for k, e := range tt.entries {
+				c.entries[k] = e
+			}
+			for p, expires := range tt.warmed {
+				c.warmed[p] = expires
+			}
+			exists, known := c.get("b", tt.key)
+			if exists != tt.wantExists || known != tt.wantKnown {
+				t.Errorf("get(%q) = %v, %v; want %v, %v", tt.key, exists, known, tt.wantExists, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestExistenceCacheExpiredEntriesAreDropped(t *testing.T) {
+	c := newExistenceCache(time.Minute)
+	c.setUntil("b", "a.txt", true, time.Now().Add(-time.Second))
+	c.warmed["b/dir/"] = time.Now().Add(-time.Second)
+
+	c.get("b", "a.txt")
+	c.get("b", "dir/x")
+	if len(c.entries) != 0 || len(c.warmed) != 0 {
+		t.Errorf("expired entries kept: %v, %v", c.entries, c.warmed)
+	}
+}
+
+// newTestS3 serves PUT and HEAD of objects from memory. Every bucket exists.
+func newTestS3(t *testing.T) *session.Session {
+	t.Helper()
+	var mu sync.Mutex
+	objects := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			io.Copy(io.Discard, r.Body)
+			objects[r.URL.Path] = true
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		case http.MethodHead:
+			isBucket := !strings.Contains(strings.Trim(r.URL.Path, "/"), "/")
+			if !isBucket && !objects[r.URL.Path] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("a", "b", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func TestExistenceCacheSeesUploads(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient(newTestS3(t), WithExistenceCache(time.Hour))
+	file := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(file, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := c.GenerateUniqueFileName(ctx, "bkt", "dir", "report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UploadFile(ctx, c.Session(), file, "bkt", "dir"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.GenerateUniqueFileName(ctx, "bkt", "dir", "report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != "report.txt" || second == first {
+		t.Errorf("generated %q then %q after uploading %q", first, second, first)
+	}
+}
@@ -0,0 +1,367 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ProbePrefix is the prefix ProbeCapabilities writes its probe object under
+const ProbePrefix = ".s3utils-probe"
+
+// Feature is an optional S3 feature that endpoints may not implement
+type Feature string
+
+// Features detected by ProbeCapabilities. Checksum algorithms are named
+// with FeatureChecksum.
+const (
+	FeatureConditionalWrites Feature = "conditional-writes"
+	FeatureTagging           Feature = "tagging"
+	FeatureACLs              Feature = "acls"
+)
+
+// FeatureChecksum returns the feature of a flexible checksum algorithm,
+// one of the s3.ChecksumAlgorithm values
+func FeatureChecksum(algorithm string) Feature {
+	return Feature("checksum-" + strings.ToLower(algorithm))
+}
+
+// UnsupportedError is returned for requests that need a feature the
+// endpoint lacks. It matches errors.ErrUnsupported.
+type UnsupportedError struct {
+	Feature   Feature
+	Operation string
+	Bucket    string
+}
+
+func (e *UnsupportedError) Error() string {
+	return "s3utils: " + e.Operation + " needs " + string(e.Feature) + ", which " + e.Bucket + " does not support"
+}
+
+// Is reports whether target is errors.ErrUnsupported
+func (e *UnsupportedError) Is(target error) bool {
+	return target == errors.ErrUnsupported
+}
+
+// Capabilities lists the optional features supported by an endpoint
+type Capabilities struct {
+	// ConditionalWrites is true when writes honor If-None-Match and If-Match
+	ConditionalWrites bool
+	// ChecksumAlgorithms are the flexible checksums the endpoint verifies
+	// and stores, as s3.ChecksumAlgorithm values
+	ChecksumAlgorithms []string
+	Tagging            bool
+	ACLs               bool
+}
+
+// Supports reports whether f is supported
+func (c *Capabilities) Supports(f Feature) bool {
+	switch f {
+	case FeatureConditionalWrites:
+		return c.ConditionalWrites
+	case FeatureTagging:
+		return c.Tagging
+	case FeatureACLs:
+		return c.ACLs
+	}
+	for _, alg := range c.ChecksumAlgorithms {
+		if FeatureChecksum(alg) == f {
+			return true
+		}
+	}
+	return false
+}
+
+// ProbeCapabilities detects the optional features of the endpoint serving
+// bucket by exercising them on a probe object under ProbePrefix, which is
+// deleted again, including its versions. An endpoint that accepts a
+// feature but ignores it, such as one storing objects despite a failed
+// If-None-Match, is reported as not supporting it, and so are features the
+// caller is denied access to.
+func ProbeCapabilities(ctx context.Context, sess *session.Session, bucket string) (*Capabilities, error) {
+	svc := s3.New(sess)
+	// A Client session would otherwise reject the probes by the
+	// capabilities it already knows
+	svc.Handlers.Build.RemoveByName(capabilityHandlerName)
+	key := JoinKey(ProbePrefix, newUUID())
+	var versions []string
+	caps := &Capabilities{}
+	defer func() {
+		cleanupProbe(context.WithoutCancel(ctx), svc, bucket, key, versions)
+	}()
+
+	put := func(input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+		input.Bucket = aws.String(bucket)
+		input.Key = aws.String(key)
+		input.Body = bytes.NewReader(probeBody)
+		out, err := svc.PutObjectWithContext(ctx, input, append(opts, internalWrite)...)
+		if err == nil && out.VersionId != nil {
+			versions = append(versions, aws.StringValue(out.VersionId))
+		}
+		return out, err
+	}
+
+	// The first write creates the object, so a second If-None-Match write
+	// must be rejected
+	ifNoneMatch := request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"})
+	_, err := put(&s3.PutObjectInput{}, ifNoneMatch)
+	switch {
+	case isUnsupported(err):
+		if _, err := put(&s3.PutObjectInput{}); err != nil {
+			return nil, wrapError(err)
+		}
+	case err != nil:
+		return nil, wrapError(err)
+	default:
+		_, err = put(&s3.PutObjectInput{}, ifNoneMatch)
+		caps.ConditionalWrites = isConditionalConflict(err)
+		if err != nil && !caps.ConditionalWrites && !isUnsupported(err) {
+			return nil, wrapError(err)
+		}
+	}
+
+	for _, alg := range s3.ChecksumAlgorithm_Values() {
+		digest, ok := probeChecksums[alg]
+		if !ok {
+			continue
+		}
+		input := &s3.PutObjectInput{ChecksumAlgorithm: aws.String(alg)}
+		setStringParam(input, "Checksum"+alg, base64.StdEncoding.EncodeToString(digest(probeBody)))
+		out, err := put(input)
+		if err != nil {
+			if isUnavailable(err) {
+				continue
+			}
+			return nil, wrapError(err)
+		}
+		// Endpoints that ignore the checksum do not echo it
+		if getStringParam(out, "Checksum"+alg) != "" {
+			caps.ChecksumAlgorithms = append(caps.ChecksumAlgorithms, alg)
+		}
+	}
+
+	_, err = svc.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Tagging: &s3.Tagging{TagSet: []*s3.Tag{{Key: aws.String("s3utils-probe"), Value: aws.String("1")}}},
+	})
+	if err != nil && !isUnavailable(err) {
+		return nil, wrapError(err)
+	}
+	caps.Tagging = err == nil
+
+	_, err = svc.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		ACL:    aws.String(s3.ObjectCannedACLPrivate),
+	})
+	if err != nil && !isUnavailable(err) {
+		return nil, wrapError(err)
+	}
+	caps.ACLs = err == nil
+	return caps, nil
+}
+
+// cleanupProbe deletes the probe object and the versions written to it
+func cleanupProbe(ctx context.Context, svc *s3.S3, bucket, key string, versions []string) {
+	if len(versions) == 0 {
+		svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		return
+	}
+	for _, v := range versions {
+		svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket:    aws.String(bucket),
+			Key:       aws.String(key),
+			VersionId: aws.String(v),
+		})
+	}
+}
+
+// probeBody is the content of the probe object
+var probeBody = []byte("s3utils capability probe")
+
+// probeChecksums compute the flexible checksums sent with the probe object,
+// which the SDK does not compute itself
+var probeChecksums = map[string]func([]byte) []byte{
+	s3.ChecksumAlgorithmCrc32: func(b []byte) []byte {
+		return binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(b))
+	},
+	s3.ChecksumAlgorithmCrc32c: func(b []byte) []byte {
+		return binary.BigEndian.AppendUint32(nil, crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli)))
+	},
+	s3.ChecksumAlgorithmSha1: func(b []byte) []byte {
+		sum := sha1.Sum(b)
+		return sum[:]
+	},
+	s3.ChecksumAlgorithmSha256: func(b []byte) []byte {
+		sum := sha256.Sum256(b)
+		return sum[:]
+	},
+}
+
+// isUnsupported reports whether err rejects a feature rather than the request
+func isUnsupported(err error) bool {
+	var rf awserr.RequestFailure
+	if errors.As(err, &rf) && rf.StatusCode() == http.StatusNotImplemented {
+		return true
+	}
+	for _, code := range []string{"NotImplemented", "AccessControlListNotSupported"} {
+		if isAWSErrorCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnavailable reports whether an optional feature cannot be used, either
+// because the endpoint lacks it or because the caller may not use it
+func isUnavailable(err error) bool {
+	return isUnsupported(err) || errors.Is(wrapError(err), ErrAccessDenied)
+}
+
+// capabilityHandlerName names the Build handler Client installs to gate requests
+const capabilityHandlerName = "s3utils.Capabilities"
+
+// capabilitySet holds the capabilities a Client gates requests with
+type capabilitySet struct {
+	mu       sync.RWMutex
+	endpoint *Capabilities
+	buckets  map[string]*Capabilities
+}
+
+func (s *capabilitySet) lookup(bucket string) *Capabilities {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if caps, ok := s.buckets[bucket]; ok {
+		return caps
+	}
+	return s.endpoint
+}
+
+// WithCapabilities gates requests made through the client by caps, for
+// endpoints whose features are known in advance, such as Cloudflare R2
+// without ACLs. Buckets probed with Client.Capabilities use their own results.
+func WithCapabilities(caps Capabilities) ClientOption {
+	return func(c *Client) {
+		c.caps.endpoint = &caps
+	}
+}
+
+// Capabilities probes the features of bucket once and caches the result.
+// From then on requests to bucket made through the client are gated by it:
+// ACLs, tags and checksums the endpoint does not support are dropped from
+// uploads and copies, since the objects are still stored correctly without
+// them, while requests that depend on a missing feature, such as
+// conditional writes or explicit tagging and ACL calls, fail with an
+// *UnsupportedError before they are sent.
+func (c *Client) Capabilities(ctx context.Context, bucket string) (*Capabilities, error) {
+	c.caps.mu.RLock()
+	caps, ok := c.caps.buckets[bucket]
+	c.caps.mu.RUnlock()
+	if ok {
+		return caps, nil
+	}
+
+	caps, err := ProbeCapabilities(ctx, c.sess, bucket)
+	if err != nil {
+		return nil, err
+	}
+	c.caps.mu.Lock()
+	defer c.caps.mu.Unlock()
+	if c.caps.buckets == nil {
+		c.caps.buckets = make(map[string]*Capabilities)
+	}
+	c.caps.buckets[bucket] = caps
+	return caps, nil
+}
+
+// Input fields dropped when the endpoint lacks ACLs or tagging
+var (
+	aclFields     = []string{"ACL", "GrantFullControl", "GrantRead", "GrantReadACP", "GrantWrite", "GrantWriteACP"}
+	taggingFields = []string{"Tagging", "TaggingDirective"}
+)
+
+// capabilityHandler applies the capabilities of the request's bucket. It
+// runs before the input is marshaled.
+func (s *capabilitySet) handler(r *request.Request) {
+	if r.ClientInfo.ServiceName != s3.ServiceName {
+		return
+	}
+	bucket := getStringParam(r.Params, "Bucket")
+	caps := s.lookup(bucket)
+	if caps == nil {
+		return
+	}
+	op := r.Operation.Name
+	unsupported := func(f Feature) {
+		r.Error = &UnsupportedError{Feature: f, Operation: op, Bucket: bucket}
+	}
+
+	switch op {
+	case "PutObjectAcl", "PutBucketAcl":
+		if !caps.ACLs {
+			unsupported(FeatureACLs)
+			return
+		}
+	case "PutObjectTagging", "GetObjectTagging", "DeleteObjectTagging":
+		if !caps.Tagging {
+			unsupported(FeatureTagging)
+			return
+		}
+	}
+
+	if !caps.ConditionalWrites && !strings.HasPrefix(op, "Get") && !strings.HasPrefix(op, "Head") {
+		conditional := getStringParam(r.Params, "IfNoneMatch") != "" || getStringParam(r.Params, "IfMatch") != "" ||
+			r.HTTPRequest.Header.Get("If-None-Match") != "" || r.HTTPRequest.Header.Get("If-Match") != ""
+		if conditional {
+			unsupported(FeatureConditionalWrites)
+			return
+		}
+	}
+
+	if !caps.ACLs {
+		clearStringParams(r.Params, aclFields...)
+	}
+	if !caps.Tagging {
+		clearStringParams(r.Params, taggingFields...)
+	}
+	for _, alg := range s3.ChecksumAlgorithm_Values() {
+		if slices.Contains(caps.ChecksumAlgorithms, alg) {
+			continue
+		}
+		clearStringParams(r.Params, "Checksum"+alg)
+		if getStringParam(r.Params, "ChecksumAlgorithm") == alg {
+			clearStringParams(r.Params, "ChecksumAlgorithm")
+		}
+	}
+}
+
+// clearStringParams sets the named *string fields of params to nil
+func clearStringParams(params interface{}, fields ...string) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	for _, field := range fields {
+		f := v.Elem().FieldByName(field)
+		if f.IsValid() && f.CanSet() && f.Type() == reflect.TypeOf((*string)(nil)) {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+}
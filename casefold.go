@@ -0,0 +1,120 @@
+package s3utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CaseSensitivity tells SyncFromS3 and DownloadPrefix whether local names
+// differing only in case are distinct files
+type CaseSensitivity int
+
+const (
+	// CaseDetect probes the local directory with a temporary file
+	CaseDetect CaseSensitivity = iota
+	// CaseSensitive treats the local file system as case-sensitive
+	CaseSensitive
+	// CaseInsensitive treats the local file system as case-insensitive, as
+	// on default Windows and macOS installations
+	CaseInsensitive
+)
+
+// CaseConflictError is returned when keys that differ only in case would be
+// written to the same file on a case-insensitive file system
+type CaseConflictError struct {
+	// Path is the local path, relative to the target directory, of the first key
+	Path string
+	Keys []string
+}
+
+func (e *CaseConflictError) Error() string {
+	return fmt.Sprintf("s3utils: keys %s differ only in case and would be written to the same file %s",
+		strings.Join(e.Keys, ", "), e.Path)
+}
+
+// insensitive reports whether names below dir are matched case-insensitively
+func (c CaseSensitivity) insensitive(dir string) (bool, error) {
+	switch c {
+	case CaseSensitive:
+		return false, nil
+	case CaseInsensitive:
+		return true, nil
+	}
+	return probeCaseInsensitive(dir)
+}
+
+// probeCaseInsensitive creates a lower-case temporary file in the nearest
+// existing directory at or above dir and checks whether its upper-case name
+// resolves to it
+func probeCaseInsensitive(dir string) (bool, error) {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false, nil
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".s3utils-case-")
+	if err != nil {
+		return false, err
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+
+	upper := filepath.Join(filepath.Dir(name), strings.ToUpper(filepath.Base(name)))
+	_, err = os.Stat(upper)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// foldCase is the name under which a case-insensitive file system stores path
+func foldCase(path string) string {
+	return strings.ToLower(path)
+}
+
+// resolveCaseConflicts gives every key of paths, which maps keys relative to
+// the prefix to local paths, a local path that is distinct ignoring case. The
+// first key in order keeps its path; the others are renamed with rename
+// applied to the last path segment, or reported as a *CaseConflictError when
+// rename is nil.
+func resolveCaseConflicts(remote map[string]ObjectInfo, paths map[string]string, rename NameFormat) error {
+	rels := make([]string, 0, len(paths))
+	for rel := range paths {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	taken := make(map[string]string, len(paths))
+	for _, rel := range rels {
+		local := paths[rel]
+		first, ok := taken[foldCase(local)]
+		if !ok {
+			taken[foldCase(local)] = rel
+			continue
+		}
+		if rename == nil {
+			return &CaseConflictError{Path: paths[first], Keys: []string{remote[first].Key, remote[rel].Key}}
+		}
+		dir, base := path.Split(local)
+		for i := 1; ok; i++ {
+			local = dir + rename(base, i)
+			_, ok = taken[foldCase(local)]
+		}
+		taken[foldCase(local)] = rel
+		paths[rel] = local
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package s3utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// DefaultChangePollInterval is how often a listing-based ChangeFeed lists the prefix
+const DefaultChangePollInterval = time.Minute
+
+// ChangeType is the kind of change reported by a ChangeFeed
+type ChangeType string
+
+// Change types
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// Change feed sources, as returned by ChangeFeed.Source
+const (
+	ChangeSourceSQS     = "sqs"
+	ChangeSourceListing = "listing"
+)
+
+// ChangeEvent is one change to an object under the feed's prefix
+type ChangeEvent struct {
+	Type ChangeType
+	Key  string
+	// Size and ETag describe the new content; they are empty for deletions
+	Size int64
+	ETag string
+	// VersionID is set for events delivered by S3 in versioned buckets
+	VersionID string
+	// Time is when S3 recorded the event, or when the listing saw it
+	Time time.Time
+}
+
+// ChangeFeedOptions configures NewChangeFeed
+type ChangeFeedOptions struct {
+	// QueueURL is an SQS queue receiving the bucket's event notifications.
+	// When empty, the notification configuration of the bucket is searched
+	// for a queue receiving all created and removed events under the prefix,
+	// and the prefix is polled with listings if there is none.
+	QueueURL string
+	// PollOnly always diffs listings, even when a queue is configured
+	PollOnly bool
+	// PollInterval is the time between listings. Zero uses DefaultChangePollInterval.
+	PollInterval time.Duration
+}
+
+// ChangeFeed yields the changes under a prefix. Events come from S3 event
+// notifications delivered to SQS when they are wired up, and otherwise from
+// comparing periodic listings. S3 notifications do not tell creation from
+// overwrite, so the SQS source reports both as ChangeCreated, while the
+// listing source reports overwrites as ChangeUpdated and only sees the last
+// change to an object between two listings.
+//
+// A ChangeFeed is not safe for concurrent use.
+type ChangeFeed struct {
+	bucket   string
+	prefix   string
+	svc      *sqs.SQS
+	queueURL string
+	interval time.Duration
+	sess     *session.Session
+
+	pending []ChangeEvent
+	// receipts are the SQS messages behind pending, deleted once the last
+	// of their events has been returned
+	receipts []*sqs.DeleteMessageBatchRequestEntry
+	snapshot map[string]ObjectInfo
+	lastPoll time.Time
+}
+
+// NewChangeFeed returns a feed of the changes under bucket/prefix. With the
+// listing source, objects that exist when the feed is created are not
+// reported; the first listing is made here.
+func NewChangeFeed(ctx context.Context, sess *session.Session, bucket, prefix string, opts ChangeFeedOptions) (*ChangeFeed, error) {
+	f := &ChangeFeed{
+		bucket:   bucket,
+		prefix:   prefix,
+		sess:     sess,
+		interval: opts.PollInterval,
+		queueURL: opts.QueueURL,
+	}
+	if f.interval <= 0 {
+		f.interval = DefaultChangePollInterval
+	}
+
+	if !opts.PollOnly && f.queueURL == "" {
+		queueARN, err := findEventQueue(ctx, sess, bucket, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if queueARN != "" {
+			if f.svc, f.queueURL, err = resolveQueue(ctx, sess, queueARN); err != nil {
+				return nil, err
+			}
+		}
+	} else if !opts.PollOnly {
+		f.svc = sqs.New(sess)
+	}
+	if f.svc != nil {
+		return f, nil
+	}
+
+	snapshot, err := listSnapshot(ctx, sess, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	f.snapshot = snapshot
+	f.lastPoll = time.Now()
+	return f, nil
+}
+
+// ChangeFeed returns a feed of the changes under bucket/prefix made through the client's session
+func (c *Client) ChangeFeed(ctx context.Context, bucket, prefix string, opts ChangeFeedOptions) (*ChangeFeed, error) {
+	return NewChangeFeed(ctx, c.sess, bucket, prefix, opts)
+}
+
+// Source returns ChangeSourceSQS or ChangeSourceListing
+func (f *ChangeFeed) Source() string {
+	if f.svc != nil {
+		return ChangeSourceSQS
+	}
+	return ChangeSourceListing
+}
+
+// Next blocks until the next change is available or ctx is done. SQS
+// messages are deleted from the queue once all of their events have been
+// returned, so events not yet returned when the process stops are delivered
+// again to the next consumer.
+func (f *ChangeFeed) Next(ctx context.Context) (ChangeEvent, error) {
+	for len(f.pending) == 0 {
+		var err error
+		if f.svc != nil {
+			err = f.receive(ctx)
+		} else {
+			err = f.poll(ctx)
+		}
+		if err != nil {
+			return ChangeEvent{}, err
+		}
+	}
+	event := f.pending[0]
+	f.pending = f.pending[1:]
+	if len(f.pending) == 0 && len(f.receipts) > 0 {
+		// Messages that fail to delete are retried after the next receive,
+		// or redelivered by SQS, so the event is returned regardless
+		f.ack(ctx)
+	}
+	return event, nil
+}
+
+// receive long-polls the queue once and queues the events under the prefix
+func (f *ChangeFeed) receive(ctx context.Context) error {
+	out, err := f.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(f.queueURL),
+		MaxNumberOfMessages: aws.Int64(sqsBatchLimit),
+		WaitTimeSeconds:     aws.Int64(20),
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	for _, msg := range out.Messages {
+		f.pending = append(f.pending, f.parseMessage(aws.StringValue(msg.Body))...)
+		f.receipts = append(f.receipts, &sqs.DeleteMessageBatchRequestEntry{
+			Id:            msg.MessageId,
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+	}
+	if len(f.pending) == 0 && len(f.receipts) > 0 {
+		// Only test events or changes outside the prefix
+		return f.ack(ctx)
+	}
+	return nil
+}
+
+// sqsBatchLimit is the most messages DeleteMessageBatch accepts
+const sqsBatchLimit = 10
+
+// ack deletes the messages whose events have all been returned. Messages
+// are kept for the next call when a batch fails.
+func (f *ChangeFeed) ack(ctx context.Context) error {
+	for len(f.receipts) > 0 {
+		n := min(len(f.receipts), sqsBatchLimit)
+		_, err := f.svc.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(f.queueURL),
+			Entries:  f.receipts[:n],
+		})
+		if err != nil {
+			return wrapError(err)
+		}
+		f.receipts = f.receipts[n:]
+	}
+	return nil
+}
+
+// s3EventMessage is the part of an S3 event notification used by the feed
+type s3EventMessage struct {
+	Records []struct {
+		EventName string    `json:"eventName"`
+		EventTime time.Time `json:"eventTime"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key       string `json:"key"`
+				Size      int64  `json:"size"`
+				ETag      string `json:"eTag"`
+				VersionID string `json:"versionId"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// parseMessage returns the events of an SQS message body holding an S3
+// event notification, directly or wrapped in an SNS notification
+func (f *ChangeFeed) parseMessage(body string) []ChangeEvent {
+	var sns struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+	if json.Unmarshal([]byte(body), &sns) == nil && sns.Type == "Notification" {
+		body = sns.Message
+	}
+	var msg s3EventMessage
+	if json.Unmarshal([]byte(body), &msg) != nil {
+		return nil
+	}
+
+	var events []ChangeEvent
+	for _, r := range msg.Records {
+		// Keys are URL-encoded with "+" for spaces
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil || r.S3.Bucket.Name != f.bucket || !strings.HasPrefix(key, f.prefix) {
+			continue
+		}
+		event := ChangeEvent{Key: key, VersionID: r.S3.Object.VersionID, Time: r.EventTime}
+		switch {
+		case strings.HasPrefix(r.EventName, "ObjectCreated:"):
+			event.Type = ChangeCreated
+			event.Size = r.S3.Object.Size
+			event.ETag = r.S3.Object.ETag
+		case strings.HasPrefix(r.EventName, "ObjectRemoved:"):
+			event.Type = ChangeDeleted
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// poll waits for the next poll time, lists the prefix and queues the
+// differences from the previous listing in key order
+func (f *ChangeFeed) poll(ctx context.Context) error {
+	if err := sleepCtx(ctx, time.Until(f.lastPoll.Add(f.interval))); err != nil {
+		return err
+	}
+	snapshot, err := listSnapshot(ctx, f.sess, f.bucket, f.prefix)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	f.lastPoll = now
+
+	for key, obj := range snapshot {
+		old, ok := f.snapshot[key]
+		switch {
+		case !ok:
+			f.pending = append(f.pending, changeFromObject(ChangeCreated, obj))
+		case old.ETag != obj.ETag || old.Size != obj.Size || !old.LastModified.Equal(obj.LastModified):
+			f.pending = append(f.pending, changeFromObject(ChangeUpdated, obj))
+		}
+	}
+	for key := range f.snapshot {
+		if _, ok := snapshot[key]; !ok {
+			f.pending = append(f.pending, ChangeEvent{Type: ChangeDeleted, Key: key, Time: now})
+		}
+	}
+	sort.Slice(f.pending, func(i, j int) bool { return f.pending[i].Key < f.pending[j].Key })
+	f.snapshot = snapshot
+	return nil
+}
+
+func changeFromObject(t ChangeType, obj ObjectInfo) ChangeEvent {
+	return ChangeEvent{Type: t, Key: obj.Key, Size: obj.Size, ETag: obj.ETag, Time: obj.LastModified}
+}
+
+// listSnapshot returns the objects under prefix keyed by key
+func listSnapshot(ctx context.Context, sess *session.Session, bucket, prefix string) (map[string]ObjectInfo, error) {
+	snapshot := make(map[string]ObjectInfo)
+	err := WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		snapshot[obj.Key] = obj
+		return true
+	})
+	return snapshot, err
+}
+
+// findEventQueue returns the ARN of an SQS queue receiving every created and
+// removed event under prefix, or "" when the bucket has none or its
+// notification configuration cannot be read
+func findEventQueue(ctx context.Context, sess *session.Session, bucket, prefix string) (string, error) {
+	rules, err := GetBucketNotification(ctx, sess, bucket)
+	if err != nil {
+		// Without access to the configuration, or on providers without
+		// notifications, fall back to listings
+		return "", ctx.Err()
+	}
+	for _, r := range rules {
+		if r.Target != NotifySQS || r.Suffix != "" || !strings.HasPrefix(prefix, r.Prefix) {
+			continue
+		}
+		var created, removed bool
+		for _, e := range r.Events {
+			created = created || e == EventObjectCreated || e == "s3:*"
+			removed = removed || e == EventObjectRemoved || e == "s3:*"
+		}
+		if created && removed {
+			return r.ARN, nil
+		}
+	}
+	return "", nil
+}
+
+// resolveQueue returns an SQS client for the queue's region and its URL
+func resolveQueue(ctx context.Context, sess *session.Session, queueARN string) (*sqs.SQS, string, error) {
+	parsed, err := arn.Parse(queueARN)
+	if err != nil {
+		return nil, "", err
+	}
+	svc := sqs.New(sess, aws.NewConfig().WithRegion(parsed.Region))
+	out, err := svc.GetQueueUrlWithContext(ctx, &sqs.GetQueueUrlInput{
+		QueueName:              aws.String(parsed.Resource),
+		QueueOwnerAWSAccountId: aws.String(parsed.AccountID),
+	})
+	if err != nil {
+		return nil, "", wrapError(err)
+	}
+	return svc, aws.StringValue(out.QueueUrl), nil
+}
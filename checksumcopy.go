@@ -0,0 +1,151 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ChecksumMismatchError is returned when a copied object does not match its
+// source, or downloaded content does not match the hash embedded in its key
+type ChecksumMismatchError struct {
+	Bucket string
+	Key    string
+	// Algorithm is the checksum algorithm compared, or "Size" when the sizes differ
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("s3utils: %s checksum mismatch for %s/%s: expected %s, got %s",
+		e.Algorithm, e.Bucket, e.Key, e.Expected, e.Actual)
+}
+
+// CopyResult describes the verification done by CopyObject
+type CopyResult struct {
+	// Algorithm is the checksum algorithm stored with the destination
+	Algorithm string
+	Checksum  string
+	// Verified reports whether the destination checksum was compared with
+	// the source. Checksums of multipart objects depend on the part layout,
+	// so only the size is compared when either side has parts.
+	Verified bool
+}
+
+// objectChecksum describes the integrity attributes of an object
+type objectChecksum struct {
+	algorithm string
+	value     string
+	parts     int64
+	size      int64
+}
+
+// getObjectChecksum reads the checksum, part count and size of an object
+func getObjectChecksum(ctx context.Context, svc *s3.S3, bucket, key string) (*objectChecksum, error) {
+	out, err := svc.GetObjectAttributesWithContext(ctx, &s3.GetObjectAttributesInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		ObjectAttributes: aws.StringSlice([]string{
+			s3.ObjectAttributesChecksum,
+			s3.ObjectAttributesObjectParts,
+			s3.ObjectAttributesObjectSize,
+		}),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	c := &objectChecksum{size: aws.Int64Value(out.ObjectSize)}
+	if out.ObjectParts != nil {
+		c.parts = aws.Int64Value(out.ObjectParts.TotalPartsCount)
+	}
+	if sum := out.Checksum; sum != nil {
+		switch {
+		case sum.ChecksumSHA256 != nil:
+			c.algorithm, c.value = s3.ChecksumAlgorithmSha256, *sum.ChecksumSHA256
+		case sum.ChecksumSHA1 != nil:
+			c.algorithm, c.value = s3.ChecksumAlgorithmSha1, *sum.ChecksumSHA1
+		case sum.ChecksumCRC32C != nil:
+			c.algorithm, c.value = s3.ChecksumAlgorithmCrc32c, *sum.ChecksumCRC32C
+		case sum.ChecksumCRC32 != nil:
+			c.algorithm, c.value = s3.ChecksumAlgorithmCrc32, *sum.ChecksumCRC32
+		}
+	}
+	return c, nil
+}
+
+// CopyObject server-side copies srcBucket/srcKey to dstBucket/dstKey,
+// keeping the source checksum algorithm (SHA-256 if the source has none)
+// and re-validating the destination with GetObjectAttributes. A mismatch is
+// reported as a *ChecksumMismatchError.
+func CopyObject(ctx context.Context, sess *session.Session, srcBucket, srcKey, dstBucket, dstKey string) (*CopyResult, error) {
+	return copyVerified(ctx, s3.New(sess), srcBucket, srcKey, dstBucket, dstKey)
+}
+
+// MoveObject copies an object like CopyObject and deletes the source once
+// the copy has been verified
+func MoveObject(ctx context.Context, sess *session.Session, srcBucket, srcKey, dstBucket, dstKey string) (*CopyResult, error) {
+	svc := s3.New(sess)
+	result, err := copyVerified(ctx, svc, srcBucket, srcKey, dstBucket, dstKey)
+	if err != nil {
+		return nil, err
+	}
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	return result, wrapError(err)
+}
+
+func copyVerified(ctx context.Context, svc *s3.S3, srcBucket, srcKey, dstBucket, dstKey string) (*CopyResult, error) {
+	src, err := getObjectChecksum(ctx, svc, srcBucket, srcKey)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := src.algorithm
+	if algorithm == "" {
+		algorithm = s3.ChecksumAlgorithmSha256
+	}
+
+	err = copyObject(ctx, svc, srcBucket, srcKey, &s3.CopyObjectInput{
+		Bucket:            aws.String(dstBucket),
+		Key:               aws.String(dstKey),
+		ChecksumAlgorithm: aws.String(algorithm),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := getObjectChecksum(ctx, svc, dstBucket, dstKey)
+	if err != nil {
+		return nil, err
+	}
+	if dst.size != src.size {
+		return nil, &ChecksumMismatchError{
+			Bucket:    dstBucket,
+			Key:       dstKey,
+			Algorithm: "Size",
+			Expected:  fmt.Sprint(src.size),
+			Actual:    fmt.Sprint(dst.size),
+		}
+	}
+
+	result := &CopyResult{Algorithm: dst.algorithm, Checksum: dst.value}
+	if src.value != "" && src.parts == 0 && dst.parts == 0 {
+		if dst.algorithm != src.algorithm || dst.value != src.value {
+			return nil, &ChecksumMismatchError{
+				Bucket:    dstBucket,
+				Key:       dstKey,
+				Algorithm: src.algorithm,
+				Expected:  src.value,
+				Actual:    dst.value,
+			}
+		}
+		result.Verified = true
+	}
+	return result, nil
+}
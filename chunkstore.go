@@ -0,0 +1,113 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ChunkID is the hex-encoded SHA-256 digest of a chunk's contents
+type ChunkID string
+
+// ChunkIDOf returns the ChunkID for data
+func ChunkIDOf(data []byte) ChunkID {
+	sum := sha256.Sum256(data)
+	return ChunkID(hex.EncodeToString(sum[:]))
+}
+
+// ChunkStore is a content-addressable store of immutable chunks under a bucket prefix.
+// Chunks are stored at prefix/<first two hex digits>/<id> so that identical
+// content is written only once.
+type ChunkStore struct {
+	sess   *session.Session
+	svc    *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewChunkStore creates a ChunkStore rooted at bucket/prefix
+func NewChunkStore(sess *session.Session, bucket, prefix string) *ChunkStore {
+	return &ChunkStore{
+		sess:   sess,
+		svc:    s3.New(sess),
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+// Key returns the object key a chunk is stored under
+func (cs *ChunkStore) Key(id ChunkID) string {
+	s := string(id)
+	if len(s) < 2 {
+		return JoinKey(cs.prefix, s)
+	}
+	return JoinKey(cs.prefix, s[:2], s)
+}
+
+// Has checks if the chunk is present in the store
+func (cs *ChunkStore) Has(ctx context.Context, id ChunkID) (bool, error) {
+	_, err := cs.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(cs.bucket),
+		Key:    aws.String(cs.Key(id)),
+	})
+	if err != nil {
+		err = wrapError(err)
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// PutChunk stores data and returns its ChunkID. Chunks that already exist are not rewritten.
+func (cs *ChunkStore) PutChunk(ctx context.Context, data []byte) (ChunkID, error) {
+	id := ChunkIDOf(data)
+	exists, err := cs.Has(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return id, nil
+	}
+
+	_, err = cs.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cs.bucket),
+		Key:         aws.String(cs.Key(id)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/octet-stream"),
+	}, internalWrite)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return id, nil
+}
+
+// GetChunk reads a chunk and verifies its contents against the id
+func (cs *ChunkStore) GetChunk(ctx context.Context, id ChunkID) ([]byte, error) {
+	out, err := cs.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cs.bucket),
+		Key:    aws.String(cs.Key(id)),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	if got := ChunkIDOf(data); got != id {
+		return nil, fmt.Errorf("s3utils: chunk %s has content hash %s", id, got)
+	}
+	return data, nil
+}
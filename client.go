@@ -0,0 +1,133 @@
+package s3utils
+
+import (
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Client carries package-wide settings applied to every S3 call made through
+// its session. The package functions accept Client.Session() in place of a
+// plain session, so uploads, downloads and direct S3 calls share the same
+// behaviour.
+type Client struct {
+	sess    *session.Session
+	svc     *s3.S3
+	cache   *existenceCache
+	metrics *RequestMetrics
+	caps    capabilitySet
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// NewClient creates a Client from sess. The session is copied, so
+// options never affect sess itself.
+func NewClient(sess *session.Session, opts ...ClientOption) *Client {
+	c := &Client{sess: sess.Copy(), metrics: newRequestMetrics()}
+	c.sess.Handlers.Send.PushFrontNamed(countRequestHandler(c.metrics))
+	c.sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: capabilityHandlerName,
+		Fn:   c.caps.handler,
+	})
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.svc = s3.New(c.sess)
+	return c
+}
+
+// Session returns the configured session for use with the package functions
+func (c *Client) Session() *session.Session {
+	return c.sess
+}
+
+// S3 returns an S3 service client built from the configured session
+func (c *Client) S3() *s3.S3 {
+	return c.svc
+}
+
+// WithRequesterPays sets RequestPayer=requester on every call that supports
+// it, so requester-pays buckets can be read and written
+func WithRequesterPays() ClientOption {
+	return func(c *Client) {
+		c.sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+			Name: "s3utils.RequesterPays",
+			Fn:   setParamHandler("RequestPayer", s3.RequestPayerRequester),
+		})
+	}
+}
+
+// WithExpectedBucketOwner sets ExpectedBucketOwner on every call that
+// supports it, so requests fail if the bucket belongs to another account
+func WithExpectedBucketOwner(accountID string) ClientOption {
+	return func(c *Client) {
+		c.sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+			Name: "s3utils.ExpectedBucketOwner",
+			Fn:   setParamHandler("ExpectedBucketOwner", accountID),
+		})
+	}
+}
+
+// WithTransferAcceleration routes requests through the S3 Transfer
+// Acceleration endpoint. The bucket must have acceleration enabled.
+func WithTransferAcceleration() ClientOption {
+	return func(c *Client) {
+		c.sess.Config.S3UseAccelerate = aws.Bool(true)
+	}
+}
+
+// WithDualStack uses the dual-stack (IPv4 and IPv6) S3 endpoints
+func WithDualStack() ClientOption {
+	return func(c *Client) {
+		c.sess.Config.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+}
+
+// WithFIPS uses the FIPS 140-2 validated S3 endpoints
+func WithFIPS() ClientOption {
+	return func(c *Client) {
+		c.sess.Config.UseFIPSEndpoint = endpoints.FIPSEndpointStateEnabled
+	}
+}
+
+// setParamHandler returns a handler that fills the named *string field of
+// the request input when the operation has one and it is not already set
+func setParamHandler(field, value string) func(*request.Request) {
+	return func(r *request.Request) {
+		if r.ClientInfo.ServiceName != s3.ServiceName {
+			return
+		}
+		setStringParam(r.Params, field, value)
+	}
+}
+
+// setStringParam sets params.<field> to value if the field exists and is nil
+func setStringParam(params interface{}, field, value string) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	f := v.Elem().FieldByName(field)
+	if !f.IsValid() || !f.CanSet() || f.Type() != reflect.TypeOf((*string)(nil)) || !f.IsNil() {
+		return
+	}
+	f.Set(reflect.ValueOf(aws.String(value)))
+}
+
+// getStringParam returns params.<field> if it is a *string field, or ""
+func getStringParam(params interface{}, field string) string {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.Elem().FieldByName(field)
+	if !f.IsValid() || f.Type() != reflect.TypeOf((*string)(nil)) {
+		return ""
+	}
+	return aws.StringValue(f.Interface().(*string))
+}
@@ -0,0 +1,332 @@
+// Command s3utils exposes the s3utils library operations on the command line.
+//
+// Usage:
+//
+//	s3utils [-region r] [-profile p] [-endpoint url] [-requester-pays] [-expected-bucket-owner id] <command> [flags] [args]
+//
+// Commands:
+//
+//	upload   <file> s3://bucket/folder
+//	download s3://bucket/key <file>
+//	sync     [-delete] <dir|s3://bucket/prefix> <dir|s3://bucket/prefix>
+//	ls       s3://bucket/prefix
+//	rm       [-r] s3://bucket/key
+//	presign  [-expires 15m] [-put] s3://bucket/key
+//	exists   s3://bucket/key
+//	security s3://bucket
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/csmanutd/s3utils"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, sess *session.Session, args []string) error
+}
+
+var commands = []command{
+	{"upload", "<file> s3://bucket/folder", runUpload},
+	{"download", "s3://bucket/key <file>", runDownload},
+	{"sync", "[-delete] <src> <dst>", runSync},
+	{"ls", "s3://bucket/prefix", runList},
+	{"rm", "[-r] s3://bucket/key", runRemove},
+	{"presign", "[-expires 15m] [-put] s3://bucket/key", runPresign},
+	{"exists", "s3://bucket/key", runExists},
+	{"security", "s3://bucket", runSecurity},
+}
+
+// errNotExist makes the exists command exit with status 1 without printing an error
+var errNotExist = errors.New("object does not exist")
+
+func main() {
+	region := flag.String("region", os.Getenv("AWS_REGION"), "AWS region")
+	profile := flag.String("profile", os.Getenv("AWS_PROFILE"), "shared config profile")
+	endpoint := flag.String("endpoint", "", "custom S3-compatible endpoint URL; a comma-separated list fails over in order")
+	requesterPays := flag.Bool("requester-pays", false, "accept requester-pays charges")
+	bucketOwner := flag.String("expected-bucket-owner", "", "fail unless buckets belong to this account ID")
+	accelerate := flag.Bool("accelerate", false, "use S3 Transfer Acceleration")
+	dualStack := flag.Bool("dualstack", false, "use dual-stack IPv4/IPv6 endpoints")
+	fips := flag.Bool("fips", false, "use FIPS endpoints")
+	credSource := flag.String("credentials", "", "force a credential source: env, profile, sso, web-identity, container or instance")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == flag.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "s3utils: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	source, err := s3utils.ParseCredentialSource(*credSource)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	endpoints := strings.Split(*endpoint, ",")
+	sess, err := s3utils.NewAWSSessionWithEndpoint(*region, *profile, endpoints[0], s3utils.WithCredentialSource(source))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "s3utils:", err)
+		os.Exit(1)
+	}
+	var clientOpts []s3utils.ClientOption
+	if len(endpoints) > 1 {
+		failover, err := s3utils.NewEndpointFailover(endpoints, s3utils.EndpointFailoverOptions{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		clientOpts = append(clientOpts, s3utils.WithEndpointFailover(failover))
+	}
+	if *requesterPays {
+		clientOpts = append(clientOpts, s3utils.WithRequesterPays())
+	}
+	if *bucketOwner != "" {
+		clientOpts = append(clientOpts, s3utils.WithExpectedBucketOwner(*bucketOwner))
+	}
+	if *accelerate {
+		clientOpts = append(clientOpts, s3utils.WithTransferAcceleration())
+	}
+	if *dualStack {
+		clientOpts = append(clientOpts, s3utils.WithDualStack())
+	}
+	if *fips {
+		clientOpts = append(clientOpts, s3utils.WithFIPS())
+	}
+	client := s3utils.NewClient(sess, clientOpts...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := cmd.run(ctx, client.Session(), flag.Args()[1:]); err != nil {
+		if !errors.Is(err, errNotExist) {
+			fmt.Fprintf(os.Stderr, "s3utils %s: %v\n", cmd.name, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: s3utils [-region r] [-profile p] [-endpoint url] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+// parseS3URL splits s3://bucket/key into bucket and key
+func parseS3URL(s string) (string, string, error) {
+	rest, ok := strings.CutPrefix(s, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("expected s3://bucket/key, got %q", s)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("missing bucket in %q", s)
+	}
+	return bucket, key, nil
+}
+
+// parseArgs parses command flags and checks the number of positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, fs.NArg())
+	}
+	return fs.Args(), nil
+}
+
+func runUpload(ctx context.Context, sess *session.Session, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("upload", flag.ExitOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	bucket, folder, err := parseS3URL(args[1])
+	if err != nil {
+		return err
+	}
+	key, err := s3utils.UploadFile(ctx, sess, args[0], bucket, folder)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("s3://%s/%s\n", bucket, key)
+	return nil
+}
+
+func runDownload(ctx context.Context, sess *session.Session, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("download", flag.ExitOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	bucket, key, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+	return s3utils.DownloadFile(ctx, sess, bucket, key, args[1])
+}
+
+func runSync(ctx context.Context, sess *session.Session, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	del := fs.Bool("delete", false, "delete destination entries missing from the source")
+	concurrency := fs.Int("concurrency", s3utils.DefaultConcurrency, "parallel transfers")
+	args, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	opts := s3utils.SyncOptions{Delete: *del, Concurrency: *concurrency}
+
+	var result *s3utils.SyncResult
+	src, dst := args[0], args[1]
+	switch {
+	case strings.HasPrefix(dst, "s3://"):
+		bucket, prefix, err := parseS3URL(dst)
+		if err != nil {
+			return err
+		}
+		result, err = s3utils.SyncToS3(ctx, sess, src, bucket, prefix, opts)
+		if err != nil {
+			return err
+		}
+	case strings.HasPrefix(src, "s3://"):
+		bucket, prefix, err := parseS3URL(src)
+		if err != nil {
+			return err
+		}
+		result, err = s3utils.SyncFromS3(ctx, sess, bucket, prefix, dst, opts)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("one of source or destination must be an s3:// URL")
+	}
+
+	for _, name := range result.Transferred {
+		fmt.Println("transferred", name)
+	}
+	for _, name := range result.Deleted {
+		fmt.Println("deleted", name)
+	}
+	fmt.Printf("%d transferred, %d deleted, %d unchanged\n", len(result.Transferred), len(result.Deleted), result.Skipped)
+	return nil
+}
+
+func runList(ctx context.Context, sess *session.Session, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("ls", flag.ExitOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	bucket, prefix, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+	return s3utils.WalkObjects(ctx, sess, bucket, prefix, func(obj s3utils.ObjectInfo) bool {
+		fmt.Printf("%s %12d %s\n", obj.LastModified.Format(time.RFC3339), obj.Size, obj.Key)
+		return true
+	})
+}
+
+func runRemove(ctx context.Context, sess *session.Session, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	recursive := fs.Bool("r", false, "delete every object under the prefix")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	bucket, key, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+	if !*recursive {
+		return s3utils.DeleteObject(ctx, sess, bucket, key)
+	}
+	n, err := s3utils.DeletePrefix(ctx, sess, bucket, key)
+	fmt.Printf("%d objects deleted\n", n)
+	return err
+}
+
+func runPresign(ctx context.Context, sess *session.Session, args []string) error {
+	fs := flag.NewFlagSet("presign", flag.ExitOnError)
+	expires := fs.Duration("expires", 15*time.Minute, "URL lifetime")
+	put := fs.Bool("put", false, "presign an upload instead of a download")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	bucket, key, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+
+	presign := s3utils.PresignGetURL
+	if *put {
+		presign = s3utils.PresignPutURL
+	}
+	url, err := presign(sess, bucket, key, *expires)
+	if err != nil {
+		return err
+	}
+	fmt.Println(url)
+	return nil
+}
+
+func runExists(ctx context.Context, sess *session.Session, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("exists", flag.ExitOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	bucket, key, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+	exists, err := s3utils.CheckS3FileExists(sess, bucket, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errNotExist
+	}
+	return nil
+}
+
+func runSecurity(ctx context.Context, sess *session.Session, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("security", flag.ExitOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	bucket, _, err := parseS3URL(args[0])
+	if err != nil {
+		return err
+	}
+	summary, err := s3utils.AnalyzeBucketSecurity(ctx, sess, bucket)
+	if err != nil {
+		return err
+	}
+	fmt.Print(summary)
+	return nil
+}
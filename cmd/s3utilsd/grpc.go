@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/csmanutd/s3utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// serviceName is the fully qualified gRPC service name
+const serviceName = "s3utils.v1.S3Utils"
+
+// jsonCodec lets the gRPC service exchange the plain request structs
+// without generated protobuf code. Clients select it with the "json"
+// content subtype, e.g. grpc.CallContentSubtype("json").
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// unaryHandler adapts a typed service method to a grpc.MethodDesc handler
+func unaryHandler[Req, Resp any](name string, fn func(*service, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(srv.(*service), ctx, req.(*Req))
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + serviceName + "/" + name,
+			}, handler)
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("Upload", (*service).Upload),
+		unaryHandler("Download", (*service).Download),
+		unaryHandler("Sync", (*service).Sync),
+		unaryHandler("Presign", (*service).Presign),
+	},
+	Metadata: "s3utils.v1",
+}
+
+// newGRPCServer creates a gRPC server exposing svc behind bearer-token authentication
+func newGRPCServer(svc *service, token string) *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		authInterceptor(token),
+		errorInterceptor,
+	))
+	srv.RegisterService(&serviceDesc, svc)
+	return srv
+}
+
+// authInterceptor requires an "authorization: Bearer <token>" metadata entry
+func authInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var got string
+		if v := md.Get("authorization"); len(v) > 0 {
+			got = v[0]
+		}
+		if !validToken(got, token) {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// errorInterceptor maps library errors onto gRPC status codes
+func errorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	code := codes.Internal
+	switch {
+	case errors.Is(err, errInvalidArgument):
+		code = codes.InvalidArgument
+	case errors.Is(err, s3utils.ErrObjectNotFound), errors.Is(err, s3utils.ErrBucketNotFound):
+		code = codes.NotFound
+	case errors.Is(err, s3utils.ErrAccessDenied):
+		code = codes.PermissionDenied
+	case errors.Is(err, s3utils.ErrThrottled):
+		code = codes.ResourceExhausted
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return nil, status.Error(code, err.Error())
+}
+
+// validToken compares an Authorization value against the configured token in constant time
+func validToken(header, token string) bool {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -0,0 +1,112 @@
+// Command s3utilsd is a sidecar that exposes the s3utils upload, download,
+// sync and presign operations over gRPC and REST so that non-Go services
+// can share the same library behaviour.
+//
+// Every request must carry "Authorization: Bearer <token>", where the token
+// is read from the S3UTILSD_TOKEN environment variable or -token-file.
+//
+// Local files and directories named in requests must lie under the directory
+// given by the required -root flag; paths are taken relative to it, and
+// requests with paths that escape it are rejected.
+//
+// REST endpoints accept and return JSON:
+//
+//	POST /v1/upload   {"file", "bucket", "folder"}
+//	POST /v1/download {"bucket", "key", "file"}
+//	POST /v1/sync     {"direction": "up"|"down", "dir", "bucket", "prefix", "delete"}
+//	POST /v1/presign  {"bucket", "key", "method", "expires"}
+//
+// The gRPC service s3utils.v1.S3Utils has the same methods and messages and
+// uses a JSON codec instead of protobuf: requests are sent with the
+// application/grpc+json content type (in Go, register a JSON encoding.Codec
+// named "json" and call with grpc.CallContentSubtype("json")).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/csmanutd/s3utils"
+)
+
+func main() {
+	region := flag.String("region", os.Getenv("AWS_REGION"), "AWS region")
+	profile := flag.String("profile", os.Getenv("AWS_PROFILE"), "shared config profile")
+	endpoint := flag.String("endpoint", "", "custom S3-compatible endpoint URL")
+	httpAddr := flag.String("http", "127.0.0.1:8080", "REST listen address, empty to disable")
+	grpcAddr := flag.String("grpc", "127.0.0.1:9090", "gRPC listen address, empty to disable")
+	tokenFile := flag.String("token-file", "", "file containing the bearer token")
+	root := flag.String("root", "", "directory request paths are confined to (required)")
+	flag.Parse()
+
+	if *root == "" {
+		log.Fatal("s3utilsd: -root is required")
+	}
+	rootDir, err := filepath.Abs(*root)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token := os.Getenv("S3UTILSD_TOKEN")
+	if *tokenFile != "" {
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		log.Fatal("s3utilsd: a bearer token is required (S3UTILSD_TOKEN or -token-file)")
+	}
+
+	sess, err := s3utils.NewAWSSessionWithEndpoint(*region, *profile, *endpoint)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := &service{sess: sess, root: rootDir}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 2)
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv := newGRPCServer(svc, token)
+		go func() { errc <- srv.Serve(lis) }()
+		defer srv.GracefulStop()
+		log.Printf("s3utilsd: gRPC listening on %s", lis.Addr())
+	}
+	if *httpAddr != "" {
+		srv := &http.Server{Addr: *httpAddr, Handler: newRESTHandler(svc, token)}
+		go func() {
+			if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errc <- err
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+		log.Printf("s3utilsd: REST listening on %s", *httpAddr)
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errc:
+		log.Print(err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/csmanutd/s3utils"
+)
+
+// newRESTHandler exposes svc as JSON POST endpoints under /v1/
+func newRESTHandler(svc *service, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/upload", restHandler(svc.Upload))
+	mux.Handle("POST /v1/download", restHandler(svc.Download))
+	mux.Handle("POST /v1/sync", restHandler(svc.Sync))
+	mux.Handle("POST /v1/presign", restHandler(svc.Presign))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && !validToken(r.Header.Get("Authorization"), token) {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// restHandler decodes a JSON request body, calls fn and encodes its response
+func restHandler[Req, Resp any](fn func(context.Context, *Req) (*Resp, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := new(Req)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			writeError(w, httpStatus(err), err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+// httpStatus maps library errors onto HTTP status codes
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, s3utils.ErrObjectNotFound), errors.Is(err, s3utils.ErrBucketNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, s3utils.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, s3utils.ErrThrottled):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
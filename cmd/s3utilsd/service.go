@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/csmanutd/s3utils"
+)
+
+// UploadRequest uploads a file from the sidecar's filesystem
+type UploadRequest struct {
+	File   string `json:"file"`
+	Bucket string `json:"bucket"`
+	Folder string `json:"folder"`
+}
+
+// UploadResponse returns the key the file was stored under
+type UploadResponse struct {
+	Key string `json:"key"`
+}
+
+// DownloadRequest downloads an object to the sidecar's filesystem
+type DownloadRequest struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	File   string `json:"file"`
+}
+
+// DownloadResponse is empty on success
+type DownloadResponse struct{}
+
+// SyncRequest synchronizes a local directory with a bucket prefix
+type SyncRequest struct {
+	// Direction is "up" (local to S3) or "down" (S3 to local)
+	Direction   string `json:"direction"`
+	Dir         string `json:"dir"`
+	Bucket      string `json:"bucket"`
+	Prefix      string `json:"prefix"`
+	Delete      bool   `json:"delete"`
+	Concurrency int    `json:"concurrency"`
+}
+
+// SyncResponse reports what the sync changed
+type SyncResponse struct {
+	Transferred []string `json:"transferred"`
+	Deleted     []string `json:"deleted"`
+	Skipped     int      `json:"skipped"`
+}
+
+// PresignRequest creates a pre-signed URL
+type PresignRequest struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	// Method is GET or PUT
+	Method string `json:"method"`
+	// Expires is a Go duration string; defaults to 15m
+	Expires string `json:"expires"`
+}
+
+// PresignResponse returns the pre-signed URL
+type PresignResponse struct {
+	URL string `json:"url"`
+}
+
+// errInvalidArgument marks request validation failures
+var errInvalidArgument = errors.New("invalid argument")
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errInvalidArgument, fmt.Sprintf(format, args...))
+}
+
+// service implements the sidecar operations shared by the gRPC and REST front ends
+type service struct {
+	sess *session.Session
+	// root is the absolute directory all request paths are confined to
+	root string
+}
+
+// resolve maps a request path, relative to the root or absolute inside it,
+// to a path under the root, rejecting paths that escape it
+func (s *service) resolve(field, name string) (string, error) {
+	rel := name
+	if filepath.IsAbs(name) {
+		var err error
+		if rel, err = filepath.Rel(s.root, name); err != nil {
+			return "", invalid("%s %q is outside the root", field, name)
+		}
+	}
+	if !filepath.IsLocal(rel) {
+		return "", invalid("%s %q is outside the root", field, name)
+	}
+	return filepath.Join(s.root, rel), nil
+}
+
+func (s *service) Upload(ctx context.Context, req *UploadRequest) (*UploadResponse, error) {
+	if req.File == "" || req.Bucket == "" {
+		return nil, invalid("file and bucket are required")
+	}
+	file, err := s.resolve("file", req.File)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s3utils.UploadFile(ctx, s.sess, file, req.Bucket, req.Folder)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadResponse{Key: key}, nil
+}
+
+func (s *service) Download(ctx context.Context, req *DownloadRequest) (*DownloadResponse, error) {
+	if req.Bucket == "" || req.Key == "" || req.File == "" {
+		return nil, invalid("bucket, key and file are required")
+	}
+	file, err := s.resolve("file", req.File)
+	if err != nil {
+		return nil, err
+	}
+	if err := s3utils.DownloadFile(ctx, s.sess, req.Bucket, req.Key, file); err != nil {
+		return nil, err
+	}
+	return &DownloadResponse{}, nil
+}
+
+func (s *service) Sync(ctx context.Context, req *SyncRequest) (*SyncResponse, error) {
+	if req.Dir == "" || req.Bucket == "" {
+		return nil, invalid("dir and bucket are required")
+	}
+	dir, err := s.resolve("dir", req.Dir)
+	if err != nil {
+		return nil, err
+	}
+	opts := s3utils.SyncOptions{Delete: req.Delete, Concurrency: req.Concurrency}
+
+	var result *s3utils.SyncResult
+	switch req.Direction {
+	case "up":
+		result, err = s3utils.SyncToS3(ctx, s.sess, dir, req.Bucket, req.Prefix, opts)
+	case "down":
+		result, err = s3utils.SyncFromS3(ctx, s.sess, req.Bucket, req.Prefix, dir, opts)
+	default:
+		return nil, invalid("direction must be up or down, got %q", req.Direction)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SyncResponse{
+		Transferred: result.Transferred,
+		Deleted:     result.Deleted,
+		Skipped:     result.Skipped,
+	}, nil
+}
+
+func (s *service) Presign(ctx context.Context, req *PresignRequest) (*PresignResponse, error) {
+	if req.Bucket == "" || req.Key == "" {
+		return nil, invalid("bucket and key are required")
+	}
+	expires := 15 * time.Minute
+	if req.Expires != "" {
+		d, err := time.ParseDuration(req.Expires)
+		if err != nil {
+			return nil, invalid("expires: %v", err)
+		}
+		expires = d
+	}
+
+	var url string
+	var err error
+	switch req.Method {
+	case "", "GET":
+		url, err = s3utils.PresignGetURL(s.sess, req.Bucket, req.Key, expires)
+	case "PUT":
+		url, err = s3utils.PresignPutURL(s.sess, req.Bucket, req.Key, expires)
+	default:
+		return nil, invalid("method must be GET or PUT, got %q", req.Method)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PresignResponse{URL: url}, nil
+}
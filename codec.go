@@ -0,0 +1,132 @@
+package s3utils
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// CodecMetadataKey is the user metadata key that may name the codec of an object
+const CodecMetadataKey = "Compression"
+
+// Codec decompresses objects stored in a particular compression format
+type Codec struct {
+	// Name identifies the codec in Content-Encoding or the Compression metadata
+	Name string
+	// Extensions are the key suffixes that select the codec, including the dot
+	Extensions []string
+	// NewReader wraps r with a decompressing reader
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec(Codec{
+		Name:       "gzip",
+		Extensions: []string{".gz", ".gzip", ".tgz"},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+	RegisterCodec(Codec{
+		Name:       "zstd",
+		Extensions: []string{".zst", ".zstd"},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	})
+	RegisterCodec(Codec{
+		Name:       "bzip2",
+		Extensions: []string{".bz2"},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(bzip2.NewReader(r)), nil
+		},
+	})
+	RegisterCodec(Codec{
+		Name:       "lz4",
+		Extensions: []string{".lz4"},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(lz4.NewReader(r)), nil
+		},
+	})
+	RegisterCodec(Codec{
+		Name:       "snappy",
+		Extensions: []string{".sz", ".snappy"},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(snappy.NewReader(r)), nil
+		},
+	})
+}
+
+// RegisterCodec adds a codec to the registry, replacing any codec with the same name
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(c.Name)] = c
+}
+
+// LookupCodec finds the codec for an object. The content encoding and
+// metadata name take precedence over the key suffix. Of the codecs matching
+// the suffix, the one with the longest extension wins, then the first by name.
+func LookupCodec(key, encoding string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	if c, ok := codecs[strings.ToLower(encoding)]; ok && encoding != "" {
+		return c, true
+	}
+	lower := strings.ToLower(key)
+	var best Codec
+	var bestName, bestExt string
+	for name, c := range codecs {
+		for _, ext := range c.Extensions {
+			ext = strings.ToLower(ext)
+			if ext == "" || !strings.HasSuffix(lower, ext) {
+				continue
+			}
+			if bestExt == "" || len(ext) > len(bestExt) || len(ext) == len(bestExt) && name < bestName {
+				best, bestName, bestExt = c, name, ext
+			}
+		}
+	}
+	return best, bestExt != ""
+}
+
+// WithDecompression decompresses the downloaded object with the registered
+// codec matching its Content-Encoding, Compression metadata or key suffix.
+// Objects without a matching codec are written unchanged.
+func WithDecompression() DownloadOption {
+	return func(c *downloadConfig) {
+		c.decompress = true
+	}
+}
+
+// decompressReader wraps r with the codec matching the object.
+// Objects without a matching codec are returned unchanged.
+func decompressReader(key string, out *s3.GetObjectOutput, r io.Reader) (io.ReadCloser, error) {
+	encoding := aws.StringValue(out.ContentEncoding)
+	if name := aws.StringValue(out.Metadata[CodecMetadataKey]); name != "" {
+		encoding = name
+	}
+	codec, ok := LookupCodec(key, encoding)
+	if !ok {
+		return io.NopCloser(r), nil
+	}
+	return codec.NewReader(r)
+}
@@ -0,0 +1,40 @@
+package s3utils
+
+import "testing"
+
+func TestLookupCodecOverlappingExtensions(t *testing.T) {
+	for _, c := range []Codec{
+		{Name: "tar+gzip", Extensions: []string{".tar.gz"}},
+		// Ties with the built-in gzip codec on ".gz"
+		{Name: "agz", Extensions: []string{".GZ"}},
+	} {
+		RegisterCodec(c)
+	}
+	t.Cleanup(func() {
+		codecsMu.Lock()
+		delete(codecs, "tar+gzip")
+		delete(codecs, "agz")
+		codecsMu.Unlock()
+	})
+
+	tests := []struct {
+		key, encoding string
+		want          string
+	}{
+		{"logs/a.tar.gz", "", "tar+gzip"},
+		{"LOGS/A.TAR.GZ", "", "tar+gzip"},
+		{"logs/a.gz", "", "agz"},
+		{"logs/a.tgz", "", "gzip"},
+		{"logs/a.tar.gz", "gzip", "gzip"},
+		{"logs/a.txt", "", ""},
+	}
+	for _, tt := range tests {
+		// Map iteration order varies, so repeat to catch order dependence
+		for range 50 {
+			c, ok := LookupCodec(tt.key, tt.encoding)
+			if ok != (tt.want != "") || c.Name != tt.want {
+				t.Fatalf("LookupCodec(%q, %q) = %q, %v; want %q", tt.key, tt.encoding, c.Name, ok, tt.want)
+			}
+		}
+	}
+}
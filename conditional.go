@@ -0,0 +1,88 @@
+package s3utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CacheMetadataSuffix is appended to the local path to name the file that
+// records the ETag of the last download
+const CacheMetadataSuffix = ".s3meta"
+
+// downloadMetadata is stored next to files fetched by DownloadIfModified
+type downloadMetadata struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// DownloadIfModified downloads an object to localPath only if it changed since
+// the previous call. The last ETag is kept in localPath+CacheMetadataSuffix
+// and sent as If-None-Match, so unchanged objects cost a single 304 response.
+// It reports whether the file was (re)downloaded.
+func DownloadIfModified(ctx context.Context, sess *session.Session, bucket, key, localPath string) (bool, error) {
+	metaPath := localPath + CacheMetadataSuffix
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	var prev downloadMetadata
+	if data, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(data, &prev) == nil &&
+		prev.Bucket == bucket && prev.Key == key && prev.ETag != "" {
+		if _, err := os.Stat(localPath); err == nil {
+			input.IfNoneMatch = aws.String(prev.ETag)
+		}
+	}
+
+	svc := s3.New(sess)
+	out, err := svc.GetObjectWithContext(ctx, input)
+	if err != nil {
+		if isAWSErrorCode(err, "NotModified") {
+			return false, nil
+		}
+		return false, wrapError(err)
+	}
+	defer out.Body.Close()
+
+	// The old file is only replaced once the new one is complete
+	if err := CheckDiskSpace(filepath.Dir(localPath), aws.Int64Value(out.ContentLength)); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, out.Body); err != nil {
+		tmp.Close()
+		return false, wrapError(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return false, err
+	}
+
+	meta, err := json.Marshal(downloadMetadata{
+		Bucket:       bucket,
+		Key:          key,
+		ETag:         aws.StringValue(out.ETag),
+		LastModified: aws.TimeValue(out.LastModified),
+	})
+	if err != nil {
+		return true, err
+	}
+	return true, os.WriteFile(metaPath, meta, 0o644)
+}
@@ -0,0 +1,105 @@
+package s3utils
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// sniffLen is the number of leading bytes examined by http.DetectContentType
+const sniffLen = 512
+
+var (
+	contentTypesMu sync.RWMutex
+	// contentTypes holds extensions that the mime package does not reliably
+	// know across platforms, plus those added by RegisterContentType
+	contentTypes = map[string]string{
+		".csv":     "text/csv",
+		".md":      "text/markdown; charset=utf-8",
+		".jsonl":   "application/x-ndjson",
+		".ndjson":  "application/x-ndjson",
+		".parquet": "application/vnd.apache.parquet",
+		".gz":      "application/gzip",
+		".tgz":     "application/gzip",
+		".zip":     "application/zip",
+		".webp":    "image/webp",
+		".avif":    "image/avif",
+		".ico":     "image/x-icon",
+	}
+)
+
+// RegisterContentType maps the key extension ext, such as ".glb", to
+// contentType for automatic detection. It overrides the built-in mapping.
+func RegisterContentType(ext, contentType string) {
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	contentTypesMu.Lock()
+	contentTypes[strings.ToLower(ext)] = contentType
+	contentTypesMu.Unlock()
+}
+
+// DetectContentType returns the content type for key from its extension,
+// falling back to sniffing head, the first bytes of the body. It returns ""
+// when neither identifies the content.
+func DetectContentType(key string, head []byte) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ext != "" {
+		contentTypesMu.RLock()
+		ct, ok := contentTypes[ext]
+		contentTypesMu.RUnlock()
+		if ok {
+			return ct
+		}
+		if ct := mime.TypeByExtension(ext); ct != "" {
+			return ct
+		}
+	}
+	if len(head) == 0 {
+		return ""
+	}
+	// DetectContentType reports unrecognised data as application/octet-stream
+	if ct := http.DetectContentType(head); ct != "application/octet-stream" {
+		return ct
+	}
+	return ""
+}
+
+// detectBodyContentType detects the content type of an upload, sniffing
+// the body only when it can be rewound
+func detectBodyContentType(key string, body io.Reader) string {
+	if ct := DetectContentType(key, nil); ct != "" {
+		return ct
+	}
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return ""
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ""
+	}
+	head := make([]byte, sniffLen)
+	n, _ := io.ReadFull(seeker, head)
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return ""
+	}
+	return DetectContentType(key, head[:n])
+}
+
+// WithContentType sets the Content-Type of the upload instead of detecting
+// it. An empty contentType leaves it unset so S3 applies its default.
+func WithContentType(contentType string) UploadOption {
+	return WithUploadInput(func(in *s3manager.UploadInput) {
+		in.ContentType = nil
+		if contentType != "" {
+			in.ContentType = aws.String(contentType)
+		}
+	})
+}
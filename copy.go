@@ -0,0 +1,135 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// maxCopyObjectSize is the largest source CopyObject accepts
+	maxCopyObjectSize = 5 << 30
+	// copyPartSize is the part size used for multipart copies
+	copyPartSize = 512 << 20
+)
+
+// copyObject server-side copies srcBucket/srcKey using in as the destination
+// settings. Sources larger than 5 GB are copied with UploadPartCopy.
+func copyObject(ctx context.Context, svc *s3.S3, srcBucket, srcKey string, in *s3.CopyObjectInput) error {
+	in.CopySource = aws.String(copySource(srcBucket, srcKey))
+
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(srcBucket),
+		Key:                  aws.String(srcKey),
+		SSECustomerAlgorithm: in.CopySourceSSECustomerAlgorithm,
+		SSECustomerKey:       in.CopySourceSSECustomerKey,
+		SSECustomerKeyMD5:    in.CopySourceSSECustomerKeyMD5,
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	size := aws.Int64Value(head.ContentLength)
+	if size <= maxCopyObjectSize {
+		_, err := svc.CopyObjectWithContext(ctx, in)
+		return wrapError(err)
+	}
+
+	create := &s3.CreateMultipartUploadInput{
+		Bucket:                    in.Bucket,
+		Key:                       in.Key,
+		ACL:                       in.ACL,
+		ChecksumAlgorithm:         in.ChecksumAlgorithm,
+		ExpectedBucketOwner:       in.ExpectedBucketOwner,
+		ObjectLockLegalHoldStatus: in.ObjectLockLegalHoldStatus,
+		ObjectLockMode:            in.ObjectLockMode,
+		ObjectLockRetainUntilDate: in.ObjectLockRetainUntilDate,
+		RequestPayer:              in.RequestPayer,
+		SSECustomerAlgorithm:      in.SSECustomerAlgorithm,
+		SSECustomerKey:            in.SSECustomerKey,
+		SSECustomerKeyMD5:         in.SSECustomerKeyMD5,
+		SSEKMSKeyId:               in.SSEKMSKeyId,
+		ServerSideEncryption:      in.ServerSideEncryption,
+		StorageClass:              in.StorageClass,
+		Tagging:                   in.Tagging,
+	}
+	if aws.StringValue(in.MetadataDirective) == s3.MetadataDirectiveReplace {
+		create.Metadata = in.Metadata
+		create.ContentType = in.ContentType
+		create.ContentEncoding = in.ContentEncoding
+		create.ContentDisposition = in.ContentDisposition
+		create.CacheControl = in.CacheControl
+	} else {
+		create.Metadata = head.Metadata
+		create.ContentType = head.ContentType
+		create.ContentEncoding = head.ContentEncoding
+		create.ContentDisposition = head.ContentDisposition
+		create.CacheControl = head.CacheControl
+	}
+
+	mpu, err := svc.CreateMultipartUploadWithContext(ctx, create)
+	if err != nil {
+		return wrapError(err)
+	}
+	abort := func() {
+		svc.AbortMultipartUploadWithContext(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   in.Bucket,
+			Key:      in.Key,
+			UploadId: mpu.UploadId,
+		})
+	}
+
+	var parts []*s3.CompletedPart
+	for n, off := int64(1), int64(0); off < size; n, off = n+1, off+copyPartSize {
+		end := off + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		out, err := svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:                         in.Bucket,
+			Key:                            in.Key,
+			UploadId:                       mpu.UploadId,
+			PartNumber:                     aws.Int64(n),
+			CopySource:                     in.CopySource,
+			CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", off, end)),
+			CopySourceSSECustomerAlgorithm: in.CopySourceSSECustomerAlgorithm,
+			CopySourceSSECustomerKey:       in.CopySourceSSECustomerKey,
+			CopySourceSSECustomerKeyMD5:    in.CopySourceSSECustomerKeyMD5,
+			ExpectedBucketOwner:            in.ExpectedBucketOwner,
+			RequestPayer:                   in.RequestPayer,
+			SSECustomerAlgorithm:           in.SSECustomerAlgorithm,
+			SSECustomerKey:                 in.SSECustomerKey,
+			SSECustomerKeyMD5:              in.SSECustomerKeyMD5,
+		})
+		if err != nil {
+			abort()
+			return wrapError(err)
+		}
+		r := out.CopyPartResult
+		parts = append(parts, &s3.CompletedPart{
+			PartNumber:     aws.Int64(n),
+			ETag:           r.ETag,
+			ChecksumCRC32:  r.ChecksumCRC32,
+			ChecksumCRC32C: r.ChecksumCRC32C,
+			ChecksumSHA1:   r.ChecksumSHA1,
+			ChecksumSHA256: r.ChecksumSHA256,
+		})
+	}
+
+	_, err = svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:               in.Bucket,
+		Key:                  in.Key,
+		UploadId:             mpu.UploadId,
+		MultipartUpload:      &s3.CompletedMultipartUpload{Parts: parts},
+		RequestPayer:         in.RequestPayer,
+		SSECustomerAlgorithm: in.SSECustomerAlgorithm,
+		SSECustomerKey:       in.SSECustomerKey,
+		SSECustomerKeyMD5:    in.SSECustomerKeyMD5,
+	})
+	if err != nil {
+		abort()
+		return wrapError(err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CounterDirName is the sub-prefix holding name reservation counters
+const CounterDirName = ".counters"
+
+// maxCounterAttempts bounds the compare-and-swap retries of a single reservation
+const maxCounterAttempts = 100
+
+// isConditionalConflict reports whether a conditional write lost a race
+func isConditionalConflict(err error) bool {
+	return isAWSErrorCode(err, "PreconditionFailed") || isAWSErrorCode(err, "ConditionalRequestConflict")
+}
+
+// ReserveCountedFileName reserves a unique file name in folder using a counter
+// object updated with conditional writes instead of probing for free names.
+// The first reservation of baseName returns it unchanged; later ones return
+// name_1.ext, name_2.ext and so on, matching GenerateUniqueFileName. Names
+// whose objects already exist, for example written before the counter was
+// used, are skipped. Every name is handed out exactly once even with many
+// concurrent writers.
+func ReserveCountedFileName(ctx context.Context, sess *session.Session, bucket, folder, baseName string) (string, error) {
+	svc := s3.New(sess)
+	counterKey := JoinKey(folder, CounterDirName, baseName)
+
+	for attempt := 0; attempt < maxCounterAttempts; attempt++ {
+		n, etag, err := readCounter(ctx, svc, bucket, counterKey)
+		if err != nil {
+			return "", err
+		}
+
+		header := map[string]string{"If-None-Match": "*"}
+		if etag != "" {
+			header = map[string]string{"If-Match": etag}
+		}
+		_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(counterKey),
+			Body:        bytes.NewReader([]byte(strconv.FormatInt(n+1, 10))),
+			ContentType: aws.String("text/plain"),
+		}, request.WithSetRequestHeaders(header), internalWrite)
+		if err != nil {
+			if isConditionalConflict(err) {
+				continue
+			}
+			return "", wrapError(err)
+		}
+
+		name := baseName
+		if n > 0 {
+			name = CounterFormat(baseName, int(n))
+		}
+		// The counter owns the name now, but an object may predate it
+		exists, err := objectExists(ctx, svc, bucket, JoinKey(folder, name), "")
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("s3utils: could not reserve a name for %s after %d attempts", baseName, maxCounterAttempts)
+}
+
+// readCounter returns the current counter value and ETag, or zero and an empty ETag if it does not exist yet
+func readCounter(ctx context.Context, svc *s3.S3, bucket, key string) (int64, string, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		err = wrapError(err)
+		if errors.Is(err, ErrObjectNotFound) {
+			return 0, "", nil
+		}
+		return 0, "", err
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("s3utils: invalid counter object %s: %w", key, err)
+	}
+	return n, aws.StringValue(out.ETag), nil
+}
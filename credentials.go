@@ -0,0 +1,244 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/processcreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// CredentialSource selects where a session obtains its credentials
+type CredentialSource string
+
+// Supported credential sources
+const (
+	// CredentialsDefault uses the SDK provider chain: environment, shared
+	// profile (including SSO and credential_process profiles), web identity,
+	// then container or instance metadata
+	CredentialsDefault CredentialSource = ""
+	// CredentialsEnv reads AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	CredentialsEnv CredentialSource = "env"
+	// CredentialsProfile uses only the shared config profile
+	CredentialsProfile CredentialSource = "profile"
+	// CredentialsSSO uses an AWS SSO session, from WithSSO or the profile sso_* settings
+	CredentialsSSO CredentialSource = "sso"
+	// CredentialsWebIdentity assumes a role with a web identity token (IRSA),
+	// from WithWebIdentity or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE
+	CredentialsWebIdentity CredentialSource = "web-identity"
+	// CredentialsProcess runs the command set by WithCredentialProcess
+	CredentialsProcess CredentialSource = "process"
+	// CredentialsContainer uses the ECS container credentials endpoint
+	CredentialsContainer CredentialSource = "container"
+	// CredentialsInstance uses the EC2 instance metadata service
+	CredentialsInstance CredentialSource = "instance"
+)
+
+// ParseCredentialSource converts a name such as "sso" or "instance" to a CredentialSource
+func ParseCredentialSource(name string) (CredentialSource, error) {
+	switch src := CredentialSource(name); src {
+	case CredentialsDefault, CredentialsEnv, CredentialsProfile, CredentialsSSO,
+		CredentialsWebIdentity, CredentialsProcess, CredentialsContainer, CredentialsInstance:
+		return src, nil
+	}
+	return "", fmt.Errorf("s3utils: unknown credential source %q", name)
+}
+
+// sessionConfig holds the state that SessionOptions act on
+type sessionConfig struct {
+	source CredentialSource
+
+	ssoAccountID, ssoRoleName, ssoStartURL, ssoRegion string
+	webRoleARN, webTokenFile                          string
+	processCommand                                    string
+}
+
+// SessionOption customizes a session created by NewAWSSession
+type SessionOption func(*sessionConfig)
+
+// WithCredentialSource forces credentials to come from src instead of the default chain
+func WithCredentialSource(src CredentialSource) SessionOption {
+	return func(c *sessionConfig) {
+		c.source = src
+	}
+}
+
+// WithSSO uses the cached AWS SSO session for startURL to obtain credentials
+// for roleName in accountID. Run "aws sso login" to populate the cache.
+func WithSSO(accountID, roleName, startURL, ssoRegion string) SessionOption {
+	return func(c *sessionConfig) {
+		c.source = CredentialsSSO
+		c.ssoAccountID, c.ssoRoleName, c.ssoStartURL, c.ssoRegion = accountID, roleName, startURL, ssoRegion
+	}
+}
+
+// WithWebIdentity assumes roleARN using the OIDC token stored in tokenFile
+func WithWebIdentity(roleARN, tokenFile string) SessionOption {
+	return func(c *sessionConfig) {
+		c.source = CredentialsWebIdentity
+		c.webRoleARN, c.webTokenFile = roleARN, tokenFile
+	}
+}
+
+// WithCredentialProcess obtains credentials from an external command that
+// prints them in the credential_process JSON format
+func WithCredentialProcess(command string) SessionOption {
+	return func(c *sessionConfig) {
+		c.source = CredentialsProcess
+		c.processCommand = command
+	}
+}
+
+// newSession creates a session from cfg and applies opts
+func newSession(cfg aws.Config, profile string, opts []SessionOption) (*session.Session, error) {
+	sc := &sessionConfig{}
+	for _, opt := range opts {
+		opt(sc)
+	}
+
+	sharedConfig := session.SharedConfigEnable
+	switch sc.source {
+	case CredentialsDefault, CredentialsProfile, CredentialsSSO:
+	default:
+		// The profile is irrelevant and must not fail session creation
+		sharedConfig, profile = session.SharedConfigDisable, ""
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           profile,
+		SharedConfigState: sharedConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := sc.credentials(sess, profile)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		sess.Config.Credentials = creds
+	}
+	sess.Handlers.Validate.PushFrontNamed(nameValidationHandler(DefaultNameRules))
+	return sess, nil
+}
+
+// credentials returns the credentials for the configured source, or nil to
+// keep the ones resolved by the session
+func (c *sessionConfig) credentials(sess *session.Session, profile string) (*credentials.Credentials, error) {
+	switch c.source {
+	case CredentialsDefault:
+		return nil, nil
+	case CredentialsEnv:
+		return credentials.NewEnvCredentials(), nil
+	case CredentialsProfile:
+		if profile == "" {
+			profile = os.Getenv("AWS_PROFILE")
+		}
+		return credentials.NewSharedCredentials("", profile), nil
+	case CredentialsSSO:
+		if c.ssoStartURL == "" {
+			// Resolved from the profile sso_* settings by the session
+			return nil, nil
+		}
+		ssoSess := sess.Copy(&aws.Config{Region: aws.String(c.ssoRegion)})
+		return ssocreds.NewCredentials(ssoSess, c.ssoAccountID, c.ssoRoleName, c.ssoStartURL), nil
+	case CredentialsWebIdentity:
+		roleARN, tokenFile := c.webRoleARN, c.webTokenFile
+		if roleARN == "" {
+			roleARN = os.Getenv("AWS_ROLE_ARN")
+		}
+		if tokenFile == "" {
+			tokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+		}
+		if roleARN == "" || tokenFile == "" {
+			return nil, errors.New("s3utils: web identity requires a role ARN and a token file")
+		}
+		return stscreds.NewWebIdentityCredentials(sess, roleARN, os.Getenv("AWS_ROLE_SESSION_NAME"), tokenFile), nil
+	case CredentialsProcess:
+		if c.processCommand == "" {
+			return nil, errors.New("s3utils: credential process requires a command")
+		}
+		return processcreds.NewCredentials(c.processCommand), nil
+	case CredentialsContainer:
+		if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") == "" && os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") == "" {
+			return nil, errors.New("s3utils: no container credentials endpoint is configured")
+		}
+		return credentials.NewCredentials(defaults.RemoteCredProvider(*sess.Config, sess.Handlers)), nil
+	case CredentialsInstance:
+		return ec2rolecreds.NewCredentials(sess), nil
+	}
+	return nil, fmt.Errorf("s3utils: unknown credential source %q", c.source)
+}
+
+// CredentialExpiring is passed to an OnCredentialExpiring hook
+type CredentialExpiring struct {
+	ExpiresAt time.Time
+	Remaining time.Duration
+}
+
+// CredentialExpiry returns when the Client credentials expire. It returns
+// the zero time for credentials that do not expire, such as static keys.
+func (c *Client) CredentialExpiry(ctx context.Context) (time.Time, error) {
+	creds := c.sess.Config.Credentials
+	if creds == nil {
+		return time.Time{}, nil
+	}
+	if _, err := creds.GetWithContext(ctx); err != nil {
+		return time.Time{}, err
+	}
+	return credentialExpiry(creds), nil
+}
+
+// credentialExpiry returns the expiry of retrieved credentials, or the zero time
+func credentialExpiry(creds *credentials.Credentials) time.Time {
+	t, err := creds.ExpiresAt()
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// WithOnCredentialExpiring calls fn once per set of credentials when a
+// request is signed with credentials expiring within threshold, so long jobs
+// can checkpoint or refresh before they expire mid-transfer
+func WithOnCredentialExpiring(threshold time.Duration, fn func(CredentialExpiring)) ClientOption {
+	var (
+		mu    sync.Mutex
+		fired time.Time
+	)
+	return func(c *Client) {
+		// Runs after signing so the credentials have been retrieved
+		c.sess.Handlers.Sign.PushBackNamed(request.NamedHandler{
+			Name: "s3utils.OnCredentialExpiring",
+			Fn: func(r *request.Request) {
+				if r.Config.Credentials == nil {
+					return
+				}
+				expiry := credentialExpiry(r.Config.Credentials)
+				remaining := time.Until(expiry)
+				if expiry.IsZero() || remaining > threshold {
+					return
+				}
+				mu.Lock()
+				first := !fired.Equal(expiry)
+				fired = expiry
+				mu.Unlock()
+				if first {
+					fn(CredentialExpiring{ExpiresAt: expiry, Remaining: remaining})
+				}
+			},
+		})
+	}
+}
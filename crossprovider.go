@@ -0,0 +1,344 @@
+package s3utils
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// SourceETagMetadataKey is the user metadata key recording the source ETag
+// of an object written by CrossProviderSync
+const SourceETagMetadataKey = "Source-Etag"
+
+// CrossSyncOptions configures CrossProviderSync
+type CrossSyncOptions struct {
+	// DstPrefix replaces prefix in the destination keys. Empty keeps the source keys.
+	DstPrefix string
+	// Delete removes destination objects under the destination prefix that
+	// no longer exist in the source
+	Delete bool
+	// Concurrency is the number of parallel transfers. Zero uses DefaultConcurrency.
+	Concurrency int
+	// PartSize is the multipart part size used for the destination. Zero
+	// uses s3manager.DefaultUploadPartSize; it is raised for objects that
+	// would otherwise need more than s3manager.MaxUploadParts parts.
+	PartSize int64
+	// OnProgress is called after every object is processed
+	OnProgress func(CrossSyncReport)
+}
+
+// CrossSyncReport counts the objects handled by CrossProviderSync
+type CrossSyncReport struct {
+	Scanned int
+	// Copied objects were streamed from the source to the destination
+	Copied int
+	// Verified counts the copies whose destination ETag matched the MD5 of
+	// the streamed content
+	Verified int
+	// Skipped objects already had a destination copy of the same source ETag
+	Skipped int
+	// Deleted lists the destination keys removed by CrossSyncOptions.Delete
+	Deleted []string
+}
+
+// CrossProviderSync mirrors bucket/prefix read through srcSess into
+// dstBucket written through dstSess, which may use another endpoint and
+// credentials, such as Cloudflare R2 or MinIO sessions created with
+// NewAWSSessionWithEndpoint. Providers cannot copy between each other, so
+// every object is streamed through this process without touching disk.
+//
+// The MD5 of the streamed content is compared with the source ETag and, in
+// single-part or multipart form, with the destination ETag; a mismatch fails
+// the sync with a *ChecksumMismatchError. ETags of KMS-encrypted objects are
+// not MD5 digests and are not compared. Each copy records the source ETag in
+// SourceETagMetadataKey metadata, so a later run skips objects that have not
+// changed since.
+func CrossProviderSync(ctx context.Context, srcSess, dstSess *session.Session, srcBucket, dstBucket, prefix string, opts CrossSyncOptions) (*CrossSyncReport, error) {
+	dstPrefix := prefix
+	if opts.DstPrefix != "" {
+		dstPrefix = opts.DstPrefix
+	}
+	objects, err := ListObjects(ctx, srcSess, srcBucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := ListObjects(ctx, dstSess, dstBucket, dstPrefix)
+	if err != nil {
+		return nil, err
+	}
+	dstObjects := make(map[string]ObjectInfo, len(existing))
+	for _, obj := range existing {
+		dstObjects[obj.Key] = obj
+	}
+
+	s := &crossSyncer{
+		srcSvc:    s3.New(srcSess),
+		dstSvc:    s3.New(dstSess),
+		dstSess:   dstSess,
+		srcBucket: srcBucket,
+		dstBucket: dstBucket,
+		opts:      opts,
+		report:    &CrossSyncReport{Scanned: len(objects)},
+	}
+	wanted := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		wanted[dstPrefix+strings.TrimPrefix(obj.Key, prefix)] = true
+	}
+
+	err = runParallel(ctx, opts.Concurrency, objects, func(ctx context.Context, obj ObjectInfo) error {
+		dstKey := dstPrefix + strings.TrimPrefix(obj.Key, prefix)
+		if dst, ok := dstObjects[dstKey]; ok && dst.Size == obj.Size {
+			current, err := s.upToDate(ctx, obj, dstKey)
+			if err != nil {
+				return err
+			}
+			if current {
+				s.record(func(rep *CrossSyncReport) { rep.Skipped++ })
+				return nil
+			}
+		}
+		verified, err := s.transfer(ctx, obj, dstKey)
+		if err != nil {
+			return fmt.Errorf("s3utils: sync %s: %w", obj.Key, err)
+		}
+		s.record(func(rep *CrossSyncReport) {
+			rep.Copied++
+			if verified {
+				rep.Verified++
+			}
+		})
+		return nil
+	})
+	if err != nil || !opts.Delete {
+		return s.report, err
+	}
+
+	var stale []string
+	for _, obj := range existing {
+		if !wanted[obj.Key] {
+			stale = append(stale, obj.Key)
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := DeleteObjects(ctx, dstSess, dstBucket, stale); err != nil {
+			return s.report, err
+		}
+		s.report.Deleted = stale
+	}
+	return s.report, nil
+}
+
+// crossSyncer holds the state shared by the CrossProviderSync workers
+type crossSyncer struct {
+	srcSvc, dstSvc       *s3.S3
+	dstSess              *session.Session
+	srcBucket, dstBucket string
+	opts                 CrossSyncOptions
+
+	mu     sync.Mutex
+	report *CrossSyncReport
+}
+
+// upToDate reports whether dstKey was copied from the current version of obj
+func (s *crossSyncer) upToDate(ctx context.Context, obj ObjectInfo, dstKey string) (bool, error) {
+	head, err := s.dstSvc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.dstBucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		// A missing bucket fails the transfer that follows
+		err = wrapError(err)
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return aws.StringValue(head.Metadata[SourceETagMetadataKey]) == obj.ETag, nil
+}
+
+// transfer streams obj to dstKey and reports whether the destination ETag
+// could be verified
+func (s *crossSyncer) transfer(ctx context.Context, obj ObjectInfo, dstKey string) (bool, error) {
+	out, err := s.srcSvc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.srcBucket),
+		Key:    aws.String(obj.Key),
+	})
+	if err != nil {
+		return false, wrapError(err)
+	}
+	defer out.Body.Close()
+
+	partSize := uploadPartSize(s.opts.PartSize, aws.Int64Value(out.ContentLength))
+	hasher := newPartHasher(partSize, md5.New)
+
+	metadata := make(map[string]*string, len(out.Metadata)+1)
+	for k, v := range out.Metadata {
+		metadata[k] = v
+	}
+	srcETag := aws.StringValue(out.ETag)
+	metadata[SourceETagMetadataKey] = aws.String(srcETag)
+	uploader := s3manager.NewUploader(s.dstSess, func(u *s3manager.Uploader) {
+		u.PartSize = partSize
+	})
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:             aws.String(s.dstBucket),
+		Key:                aws.String(dstKey),
+		Body:               io.TeeReader(out.Body, hasher),
+		ContentType:        out.ContentType,
+		ContentEncoding:    out.ContentEncoding,
+		ContentDisposition: out.ContentDisposition,
+		CacheControl:       out.CacheControl,
+		Metadata:           metadata,
+	})
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	// A bad copy is removed so its SourceETagMetadataKey does not make the
+	// next run skip it
+	mismatch := func(bucket, key, expected, actual string) error {
+		s.dstSvc.DeleteObjectWithContext(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+			Bucket: aws.String(s.dstBucket),
+			Key:    aws.String(dstKey),
+		})
+		return &ChecksumMismatchError{Bucket: bucket, Key: key, Algorithm: "MD5", Expected: expected, Actual: actual}
+	}
+	// The source ETag only shows read corruption for single-part objects
+	if isMD5ETag(srcETag) && aws.StringValue(out.ServerSideEncryption) != s3.ServerSideEncryptionAwsKms {
+		if actual := hasher.etag(0); actual != strings.Trim(srcETag, `"`) {
+			return false, mismatch(s.srcBucket, obj.Key, strings.Trim(srcETag, `"`), actual)
+		}
+	}
+
+	head, err := s.dstSvc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.dstBucket),
+		Key:    aws.String(dstKey),
+	})
+	if err != nil {
+		return false, wrapError(err)
+	}
+	dstETag := strings.Trim(aws.StringValue(head.ETag), `"`)
+	if aws.StringValue(head.ServerSideEncryption) == s3.ServerSideEncryptionAwsKms {
+		return false, nil
+	}
+	parts := 0
+	if i := strings.LastIndexByte(dstETag, '-'); i >= 0 {
+		if _, err := fmt.Sscan(dstETag[i+1:], &parts); err != nil {
+			return false, nil
+		}
+	} else if !isMD5ETag(dstETag) {
+		return false, nil
+	}
+	if expected := hasher.etag(parts); expected != dstETag {
+		return false, mismatch(s.dstBucket, dstKey, expected, dstETag)
+	}
+	return true, nil
+}
+
+func (s *crossSyncer) record(update func(*CrossSyncReport)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s.report)
+	if s.opts.OnProgress != nil {
+		s.opts.OnProgress(*s.report)
+	}
+}
+
+// isMD5ETag reports whether etag is a plain MD5 digest rather than a
+// multipart ETag
+func isMD5ETag(etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	return len(etag) == 2*md5.Size && isHex(etag)
+}
+
+// uploadPartSize returns the part size the transfer manager uses for size
+// bytes: partSize, or the default if zero, raised so the upload fits in
+// MaxUploadParts parts
+func uploadPartSize(partSize, size int64) int64 {
+	if partSize <= 0 {
+		partSize = s3manager.DefaultUploadPartSize
+	}
+	if floor := (size + s3manager.MaxUploadParts - 1) / s3manager.MaxUploadParts; partSize < floor {
+		partSize = floor
+	}
+	return partSize
+}
+
+// partHasher digests content as a whole and in parts of partSize, giving the
+// ETags and checksums S3-compatible stores report for content uploaded in
+// one request or in parts
+type partHasher struct {
+	partSize int64
+	newHash  func() hash.Hash
+	whole    hash.Hash
+	part     hash.Hash
+	partLen  int64
+	digests  []byte
+}
+
+func newPartHasher(partSize int64, newHash func() hash.Hash) *partHasher {
+	return &partHasher{partSize: partSize, newHash: newHash, whole: newHash(), part: newHash()}
+}
+
+func (h *partHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	h.whole.Write(p)
+	for len(p) > 0 {
+		chunk := p
+		if room := h.partSize - h.partLen; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		h.part.Write(chunk)
+		h.partLen += int64(len(chunk))
+		p = p[len(chunk):]
+		if h.partLen == h.partSize {
+			h.digests = h.part.Sum(h.digests)
+			h.part.Reset()
+			h.partLen = 0
+		}
+	}
+	return n, nil
+}
+
+// sum returns the digest of the whole content for parts == 0, and otherwise
+// the digest of the part digests, which is nil when the content does not
+// split into that many parts
+func (h *partHasher) sum(parts int) []byte {
+	if parts == 0 {
+		return h.whole.Sum(nil)
+	}
+	digests := h.digests
+	if h.partLen > 0 {
+		digests = h.part.Sum(append([]byte(nil), digests...))
+	}
+	if len(digests) != parts*h.part.Size() {
+		return nil
+	}
+	composite := h.newHash()
+	composite.Write(digests)
+	return composite.Sum(nil)
+}
+
+// etag returns the plain MD5 for parts == 0, and otherwise the multipart
+// ETag, which is empty when the content does not split into that many parts
+func (h *partHasher) etag(parts int) string {
+	sum := h.sum(parts)
+	if sum == nil {
+		return ""
+	}
+	if parts == 0 {
+		return hex.EncodeToString(sum)
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum), parts)
+}
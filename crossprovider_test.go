@@ -0,0 +1,81 @@
+package s3utils
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// multipartETag computes the ETag of data uploaded in parts of partSize
+// independently of partHasher
+func multipartETag(data []byte, partSize int) string {
+	var digests []byte
+	parts := 0
+	for len(data) > 0 {
+		n := min(partSize, len(data))
+		sum := md5.Sum(data[:n])
+		digests = append(digests, sum[:]...)
+		data = data[n:]
+		parts++
+	}
+	sum := md5.Sum(digests)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), parts)
+}
+
+func TestPartHasherETag(t *testing.T) {
+	const partSize = 4
+	tests := []struct {
+		size  int
+		parts int
+		want  func(data []byte) string
+	}{
+		{0, 0, func(d []byte) string { s := md5.Sum(d); return hex.EncodeToString(s[:]) }},
+		{10, 0, func(d []byte) string { s := md5.Sum(d); return hex.EncodeToString(s[:]) }},
+		{3, 1, func(d []byte) string { return multipartETag(d, partSize) }},
+		{4, 1, func(d []byte) string { return multipartETag(d, partSize) }},
+		{5, 2, func(d []byte) string { return multipartETag(d, partSize) }},
+		{8, 2, func(d []byte) string { return multipartETag(d, partSize) }},
+		{9, 3, func(d []byte) string { return multipartETag(d, partSize) }},
+		{9, 2, func([]byte) string { return "" }},
+		{8, 3, func([]byte) string { return "" }},
+	}
+	for _, tt := range tests {
+		data := bytes.Repeat([]byte("abc"), tt.size)[:tt.size]
+		want := tt.want(data)
+		// Writes of every size must split the parts the same way
+		for _, chunk := range []int{1, 3, partSize, 100} {
+			t.Run(fmt.Sprintf("size %d parts %d chunk %d", tt.size, tt.parts, chunk), func(t *testing.T) {
+				h := newPartHasher(partSize, md5.New)
+				for p := data; len(p) > 0; {
+					n := min(chunk, len(p))
+					h.Write(p[:n])
+					p = p[n:]
+				}
+				if got := h.etag(tt.parts); got != want {
+					t.Errorf("etag(%d) = %q, want %q", tt.parts, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestIsMD5ETag(t *testing.T) {
+	tests := []struct {
+		etag string
+		want bool
+	}{
+		{`"9e107d9d372bb6826bd81d3542a419d6"`, true},
+		{"9e107d9d372bb6826bd81d3542a419d6", true},
+		{`"9e107d9d372bb6826bd81d3542a419d6-3"`, false},
+		{`"9e107d9d372bb6826bd81d3542a419"`, false},
+		{`"zz107d9d372bb6826bd81d3542a419d6"`, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isMD5ETag(tt.etag); got != tt.want {
+			t.Errorf("isMD5ETag(%q) = %v, want %v", tt.etag, got, tt.want)
+		}
+	}
+}
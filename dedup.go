@@ -0,0 +1,142 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ContentSHA256MetadataKey is the user metadata key holding the hex SHA-256
+// of an object uploaded by UploadIfNotDuplicate
+const ContentSHA256MetadataKey = "Content-Sha256"
+
+// DuplicateOfMetadataKey is the user metadata key of a link object naming
+// the object whose content it stands for
+const DuplicateOfMetadataKey = "Duplicate-Of"
+
+// DuplicateAction selects what UploadIfNotDuplicate does when the content
+// is already stored under the folder
+type DuplicateAction int
+
+const (
+	// DuplicateSkip writes nothing and reports the existing object
+	DuplicateSkip DuplicateAction = iota
+	// DuplicateLink writes an empty object at the new key whose metadata
+	// and website redirect point at the existing object
+	DuplicateLink
+)
+
+// DedupResult describes the outcome of UploadIfNotDuplicate
+type DedupResult struct {
+	// Upload is the result of uploading the file or writing the link, nil when skipped
+	Upload *UploadResult
+	// Duplicate is the key of the existing object with the same content,
+	// empty when the file was uploaded
+	Duplicate string
+	// SHA256 is the hex digest of the file
+	SHA256 string
+}
+
+// UploadIfNotDuplicate uploads a file to folder/<base name> like
+// UploadFileWithResult unless an object with the same SHA-256 already exists
+// under folder, in which case action decides between skipping and linking.
+// Existing objects match by ContentSHA256MetadataKey metadata or, for
+// single-part uploads, by their S3 SHA-256 checksum; only objects of the
+// same size are inspected. Uploaded files carry the metadata so later calls
+// find them.
+func UploadIfNotDuplicate(ctx context.Context, sess *session.Session, fileName, bucket, folder string, action DuplicateAction, opts ...UploadOption) (*DedupResult, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := fileSHA256Hex(fileName)
+	if err != nil {
+		return nil, err
+	}
+	key := JoinKey(folder, filepath.Base(fileName))
+	result := &DedupResult{SHA256: sum}
+
+	dup, err := findDuplicate(ctx, sess, bucket, folder, info.Size(), sum)
+	if err != nil {
+		return nil, err
+	}
+	if dup == "" {
+		opts = append([]UploadOption{withUserMetadata(ContentSHA256MetadataKey, sum)}, opts...)
+		result.Upload, err = uploadFileToKey(ctx, sess, fileName, bucket, key, opts...)
+		return result, err
+	}
+
+	result.Duplicate = dup
+	if action != DuplicateLink || dup == key {
+		return result, nil
+	}
+	cfg := newUploadConfig(bucket, key, bytes.NewReader(nil), opts)
+	withUserMetadata(DuplicateOfMetadataKey, dup)(cfg)
+	withUserMetadata(ContentSHA256MetadataKey, sum)(cfg)
+	cfg.input.ContentType = nil
+	cfg.input.WebsiteRedirectLocation = aws.String("/" + dup)
+	result.Upload, err = cfg.upload(ctx, sess)
+	return result, err
+}
+
+// findDuplicate returns the key of an object under folder with the given
+// size and hex SHA-256, or "" when there is none. Links are never returned.
+func findDuplicate(ctx context.Context, sess *session.Session, bucket, folder string, size int64, sum string) (string, error) {
+	prefix := strings.TrimSuffix(folder, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	objects, err := ListObjects(ctx, sess, bucket, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := hex.DecodeString(sum)
+	if err != nil {
+		return "", err
+	}
+	checksum := base64.StdEncoding.EncodeToString(raw)
+	svc := s3.New(sess)
+	for _, obj := range objects {
+		if obj.Size != size {
+			continue
+		}
+		head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket:       aws.String(bucket),
+			Key:          aws.String(obj.Key),
+			ChecksumMode: aws.String(s3.ChecksumModeEnabled),
+		})
+		if err != nil {
+			if isAWSErrorCode(err, "NotFound") {
+				continue
+			}
+			return "", wrapError(err)
+		}
+		if head.Metadata[DuplicateOfMetadataKey] != nil {
+			continue
+		}
+		if aws.StringValue(head.Metadata[ContentSHA256MetadataKey]) == sum || aws.StringValue(head.ChecksumSHA256) == checksum {
+			return obj.Key, nil
+		}
+	}
+	return "", nil
+}
+
+// withUserMetadata sets one user metadata entry on the upload
+func withUserMetadata(name, value string) UploadOption {
+	return WithUploadInput(func(in *s3manager.UploadInput) {
+		if in.Metadata == nil {
+			in.Metadata = make(map[string]*string)
+		}
+		in.Metadata[name] = aws.String(value)
+	})
+}
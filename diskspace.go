@@ -0,0 +1,69 @@
+package s3utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DiskSpaceHeadroom is the free space CheckDiskSpace leaves on top of the
+// requirement, so an operation does not fill the file system to the last block
+var DiskSpaceHeadroom int64 = 64 << 20
+
+// InsufficientSpaceError is returned when a local directory does not have
+// the free space an operation is estimated to need
+type InsufficientSpaceError struct {
+	Path string
+	// Required includes DiskSpaceHeadroom
+	Required  int64
+	Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("s3utils: %s needs %d bytes of free space, %d available", e.Path, e.Required, e.Available)
+}
+
+// CheckDiskSpace returns an *InsufficientSpaceError when the file system
+// holding dir has less than required bytes plus DiskSpaceHeadroom available
+// to the process. dir need not exist yet; its nearest existing parent is
+// checked. On platforms where free space cannot be queried the check passes.
+func CheckDiskSpace(dir string, required int64) error {
+	if required <= 0 {
+		return nil
+	}
+	existing, err := existingParent(dir)
+	if err != nil {
+		return err
+	}
+	available, err := freeSpace(existing)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if required += DiskSpaceHeadroom; available < required {
+		return &InsufficientSpaceError{Path: dir, Required: required, Available: available}
+	}
+	return nil
+}
+
+// existingParent returns dir or its nearest ancestor that exists
+func existingParent(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		_, err := os.Stat(dir)
+		if err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if !errors.Is(err, os.ErrNotExist) || parent == dir {
+			return "", err
+		}
+		dir = parent
+	}
+}
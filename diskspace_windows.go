@@ -0,0 +1,19 @@
+//go:build windows
+
+package s3utils
+
+import "golang.org/x/sys/windows"
+
+// freeSpace returns the bytes available to the calling user on the volume
+// holding dir, taking disk quotas into account
+func freeSpace(dir string) (int64, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,214 @@
+package s3utils
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// Object metadata keys written by client-side envelope encryption
+const (
+	cseAlgorithmMeta = "Cse-Algorithm"
+	cseKeyMeta       = "Cse-Key"
+	cseNonceMeta     = "Cse-Nonce"
+	cseKMSKeyMeta    = "Cse-Kms-Key-Id"
+)
+
+// cseAlgorithm names the on-object format: AES-256-GCM over 64 KiB segments
+const cseAlgorithm = "AES256-GCM-STREAM-64K"
+
+const (
+	cseSegmentSize = 64 << 10
+	cseNoncePrefix = 7
+)
+
+// ErrNotEncrypted is returned when decrypting an object that has no envelope encryption metadata
+var ErrNotEncrypted = errors.New("s3utils: object is not client-side encrypted")
+
+// EnvelopeEncryption encrypts objects on the client with a per-object AES-256
+// data key that is wrapped by a KMS key and stored in the object metadata
+type EnvelopeEncryption struct {
+	kms   *kms.KMS
+	keyID string
+	// EncryptionContext is passed to KMS when wrapping and unwrapping data keys
+	EncryptionContext map[string]string
+}
+
+// NewEnvelopeEncryption creates an EnvelopeEncryption using the KMS key keyID
+func NewEnvelopeEncryption(sess *session.Session, keyID string) *EnvelopeEncryption {
+	return &EnvelopeEncryption{kms: kms.New(sess), keyID: keyID}
+}
+
+// WithClientSideEncryption encrypts the upload body before it leaves the process
+func WithClientSideEncryption(e *EnvelopeEncryption) UploadOption {
+	return func(c *uploadConfig) {
+		c.encrypt = e
+	}
+}
+
+// WithClientSideDecryption decrypts an object written with WithClientSideEncryption
+func WithClientSideDecryption(e *EnvelopeEncryption) DownloadOption {
+	return func(c *downloadConfig) {
+		c.decrypt = e
+	}
+}
+
+// encryptUpload replaces the upload body with its ciphertext and records the wrapped key in the metadata
+func (e *EnvelopeEncryption) encryptUpload(ctx context.Context, c *uploadConfig) error {
+	dk, err := e.kms.GenerateDataKeyWithContext(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(e.keyID),
+		KeySpec:           aws.String(kms.DataKeySpecAes256),
+		EncryptionContext: aws.StringMap(e.EncryptionContext),
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	aead, err := newAEAD(dk.Plaintext)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, cseNoncePrefix)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+
+	if c.input.Metadata == nil {
+		c.input.Metadata = make(map[string]*string)
+	}
+	c.input.Metadata[cseAlgorithmMeta] = aws.String(cseAlgorithm)
+	c.input.Metadata[cseKeyMeta] = aws.String(base64.StdEncoding.EncodeToString(dk.CiphertextBlob))
+	c.input.Metadata[cseNonceMeta] = aws.String(base64.StdEncoding.EncodeToString(prefix))
+	c.input.Metadata[cseKMSKeyMeta] = dk.KeyId
+
+	pr, pw := io.Pipe()
+	plain := c.input.Body
+	go func() {
+		pw.CloseWithError(sealStream(aead, prefix, plain, pw))
+	}()
+	c.input.Body = pr
+	return nil
+}
+
+// decryptReader unwraps the data key from metadata and returns a reader of the plaintext
+func (e *EnvelopeEncryption) decryptReader(ctx context.Context, metadata map[string]*string, r io.Reader) (io.ReadCloser, error) {
+	if aws.StringValue(metadata[cseAlgorithmMeta]) != cseAlgorithm {
+		return nil, ErrNotEncrypted
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(aws.StringValue(metadata[cseKeyMeta]))
+	if err != nil {
+		return nil, fmt.Errorf("s3utils: invalid wrapped key: %w", err)
+	}
+	prefix, err := base64.StdEncoding.DecodeString(aws.StringValue(metadata[cseNonceMeta]))
+	if err != nil || len(prefix) != cseNoncePrefix {
+		return nil, errors.New("s3utils: invalid encryption nonce")
+	}
+
+	out, err := e.kms.DecryptWithContext(ctx, &kms.DecryptInput{
+		CiphertextBlob:    wrapped,
+		EncryptionContext: aws.StringMap(e.EncryptionContext),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	aead, err := newAEAD(out.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(openStream(aead, prefix, r, pw))
+	}()
+	return pr, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce builds the nonce for segment i: prefix || uint32 counter || last-segment flag
+func segmentNonce(prefix []byte, i uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[cseNoncePrefix:], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// readSegment fills buf from r and reports whether the stream ended
+func readSegment(r io.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	return n, false, err
+}
+
+// sealStream encrypts r into w as a sequence of authenticated segments.
+// The last segment is flagged in its nonce so truncation is detected.
+func sealStream(aead cipher.AEAD, prefix []byte, r io.Reader, w io.Writer) error {
+	return segmentStream(r, cseSegmentSize, func(i uint32, last bool, data []byte) error {
+		_, err := w.Write(aead.Seal(nil, segmentNonce(prefix, i, last), data, nil))
+		return err
+	})
+}
+
+// openStream decrypts segments written by sealStream from r into w
+func openStream(aead cipher.AEAD, prefix []byte, r io.Reader, w io.Writer) error {
+	return segmentStream(r, cseSegmentSize+aead.Overhead(), func(i uint32, last bool, data []byte) error {
+		if len(data) == 0 {
+			return errors.New("s3utils: encrypted object is truncated")
+		}
+		plain, err := aead.Open(nil, segmentNonce(prefix, i, last), data, nil)
+		if err != nil {
+			return fmt.Errorf("s3utils: decrypt segment %d: %w", i, err)
+		}
+		_, err = w.Write(plain)
+		return err
+	})
+}
+
+// segmentStream splits r into size-byte segments and calls fn for each,
+// reading one segment ahead so the final segment can be flagged
+func segmentStream(r io.Reader, size int, fn func(i uint32, last bool, data []byte) error) error {
+	cur := make([]byte, size)
+	next := make([]byte, size)
+	n, eof, err := readSegment(r, cur)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); ; i++ {
+		last := eof
+		var m int
+		if !last {
+			m, eof, err = readSegment(r, next)
+			if err != nil {
+				return err
+			}
+			last = m == 0
+		}
+		if err := fn(i, last, cur[:n]); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		cur, next, n = next, cur, m
+	}
+}
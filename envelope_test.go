@@ -0,0 +1,129 @@
+package s3utils
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+func TestSegmentStream(t *testing.T) {
+	type segment struct {
+		i    uint32
+		last bool
+		n    int
+	}
+	tests := []struct {
+		size int
+		want []segment
+	}{
+		{0, []segment{{0, true, 0}}},
+		{3, []segment{{0, true, 3}}},
+		{4, []segment{{0, true, 4}}},
+		{5, []segment{{0, false, 4}, {1, true, 1}}},
+		{8, []segment{{0, false, 4}, {1, true, 4}}},
+		{9, []segment{{0, false, 4}, {1, false, 4}, {2, true, 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			data := bytes.Repeat([]byte{'x'}, tt.size)
+			var got []segment
+			var joined []byte
+			err := segmentStream(bytes.NewReader(data), 4, func(i uint32, last bool, b []byte) error {
+				got = append(got, segment{i, last, len(b)})
+				joined = append(joined, b...)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("segments = %v, want %v", got, tt.want)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Errorf("segments hold %d bytes, want %d", len(joined), len(data))
+			}
+		})
+	}
+}
+
+// newTestAEAD returns an AEAD with a random key and a random nonce prefix
+func newTestAEAD(t *testing.T) (cipher.AEAD, []byte) {
+	t.Helper()
+	key := make([]byte, 32)
+	prefix := make([]byte, cseNoncePrefix)
+	rand.Read(key)
+	rand.Read(prefix)
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead, prefix
+}
+
+func TestSealOpenStream(t *testing.T) {
+	aead, prefix := newTestAEAD(t)
+	for _, size := range []int{0, 1, cseSegmentSize - 1, cseSegmentSize, cseSegmentSize + 1, 2*cseSegmentSize + 5} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			plain := make([]byte, size)
+			rand.Read(plain)
+			var sealed, opened bytes.Buffer
+			if err := sealStream(aead, prefix, bytes.NewReader(plain), &sealed); err != nil {
+				t.Fatal(err)
+			}
+			segments := (size + cseSegmentSize - 1) / cseSegmentSize
+			if segments == 0 {
+				segments = 1
+			}
+			if want := size + segments*aead.Overhead(); sealed.Len() != want {
+				t.Errorf("sealed %d bytes, want %d", sealed.Len(), want)
+			}
+			if err := openStream(aead, prefix, &sealed, &opened); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(opened.Bytes(), plain) {
+				t.Error("opened stream differs from the plaintext")
+			}
+		})
+	}
+}
+
+func TestOpenStreamRejectsDamage(t *testing.T) {
+	aead, prefix := newTestAEAD(t)
+	plain := make([]byte, 2*cseSegmentSize+5)
+	var sealed bytes.Buffer
+	if err := sealStream(aead, prefix, bytes.NewReader(plain), &sealed); err != nil {
+		t.Fatal(err)
+	}
+	full := sealed.Bytes()
+	segment := cseSegmentSize + aead.Overhead()
+
+	otherPrefix := append([]byte(nil), prefix...)
+	otherPrefix[0] ^= 1
+	tests := []struct {
+		name   string
+		data   []byte
+		prefix []byte
+	}{
+		{"empty", nil, prefix},
+		{"last segment dropped", full[:2*segment], prefix},
+		{"cut inside a segment", full[:segment+10], prefix},
+		{"flipped byte", flipByte(full, segment+1), prefix},
+		{"segments swapped", append(append(append([]byte(nil), full[segment:2*segment]...), full[:segment]...), full[2*segment:]...), prefix},
+		{"wrong nonce prefix", full, otherPrefix},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := openStream(aead, tt.prefix, bytes.NewReader(tt.data), &bytes.Buffer{}); err == nil {
+				t.Error("damaged stream was opened")
+			}
+		})
+	}
+}
+
+func flipByte(b []byte, i int) []byte {
+	b = append([]byte(nil), b...)
+	b[i] ^= 0xff
+	return b
+}
@@ -0,0 +1,106 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Sentinel errors returned by the package. Use errors.Is to test for them;
+// the underlying AWS error remains reachable through errors.As.
+var (
+	ErrObjectNotFound = errors.New("s3utils: object not found")
+	ErrBucketNotFound = errors.New("s3utils: bucket not found")
+	ErrAccessDenied   = errors.New("s3utils: access denied")
+	ErrThrottled      = errors.New("s3utils: request throttled")
+)
+
+// Error wraps an AWS error together with the sentinel error it maps to
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns both the sentinel and the underlying AWS error
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// wrapError maps AWS error codes onto the package sentinel errors.
+// Errors that carry no known code, directly or through the errors they
+// wrap, are returned unchanged. A bare NotFound from a HEAD request is
+// mapped to ErrObjectNotFound even when the bucket is missing; use
+// missingBucketError where the difference matters.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if errors.As(err, &typed) {
+		return err
+	}
+
+	// Wrapper codes such as s3manager's MultipartUpload keep the cause in OrigErr
+	var kind error
+	for e := err; e != nil && kind == nil; {
+		var aerr awserr.Error
+		if !errors.As(e, &aerr) {
+			break
+		}
+		kind = errorKind(aerr)
+		e = aerr.OrigErr()
+	}
+	if kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// errorKind returns the sentinel error for the code of aerr, or nil
+func errorKind(aerr awserr.Error) error {
+	switch aerr.Code() {
+	case "NotFound", "NoSuchKey", "NoSuchVersion":
+		return ErrObjectNotFound
+	case "NoSuchBucket":
+		return ErrBucketNotFound
+	case "AccessDenied", "Forbidden", "AllAccessDisabled":
+		return ErrAccessDenied
+	case "SlowDown", "TooManyRequests":
+		return ErrThrottled
+	}
+	if request.IsErrorThrottle(aerr) {
+		return ErrThrottled
+	}
+	return nil
+}
+
+// missingBucketError returns ErrBucketNotFound if bucket does not exist.
+// S3 answers a HEAD for a missing bucket with the same bare NotFound as for
+// a missing key, so callers that must tell them apart check after a miss.
+func missingBucketError(ctx context.Context, svc *s3.S3, bucket string) error {
+	_, err := svc.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if isAWSErrorCode(err, "NotFound") || isAWSErrorCode(err, s3.ErrCodeNoSuchBucket) {
+		return &Error{Kind: ErrBucketNotFound, Err: err}
+	}
+	return nil
+}
+
+// awsErrorf builds an awserr.Error for failures reported inside a successful response
+func awsErrorf(code, format string, args ...interface{}) error {
+	return awserr.New(code, fmt.Sprintf(format, args...), nil)
+}
+
+// isAWSErrorCode reports whether err carries the given AWS error code
+func isAWSErrorCode(err error, code string) bool {
+	var aerr awserr.Error
+	return errors.As(err, &aerr) && aerr.Code() == code
+}
@@ -0,0 +1,51 @@
+package s3utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"NoSuchKey", awserr.New("NoSuchKey", "", nil), ErrObjectNotFound},
+		{"HEAD NotFound", awserr.New("NotFound", "", nil), ErrObjectNotFound},
+		{"NoSuchBucket", awserr.New("NoSuchBucket", "", nil), ErrBucketNotFound},
+		{"AccessDenied", awserr.New("AccessDenied", "", nil), ErrAccessDenied},
+		{"SlowDown", awserr.New("SlowDown", "", nil), ErrThrottled},
+		{"SDK throttle code", awserr.New("RequestLimitExceeded", "", nil), ErrThrottled},
+		{"wrapped by fmt", fmt.Errorf("upload: %w", awserr.New("NoSuchBucket", "", nil)), ErrBucketNotFound},
+		{"multipart upload cause", awserr.New("MultipartUpload", "upload multipart failed", awserr.New("NoSuchBucket", "", nil)), ErrBucketNotFound},
+		{"nested cause", awserr.New("MultipartUpload", "", awserr.New("RequestError", "", awserr.New("AccessDenied", "", nil))), ErrAccessDenied},
+		{"unknown code", awserr.New("InternalError", "", nil), nil},
+		{"unknown cause", awserr.New("MultipartUpload", "", errors.New("disk full")), nil},
+		{"plain error", errors.New("boom"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapError(tt.err)
+			if tt.want == nil {
+				if got != tt.err {
+					t.Errorf("wrapError = %v, want the error unchanged", got)
+				}
+				return
+			}
+			if !errors.Is(got, tt.want) {
+				t.Errorf("wrapError = %v, not %v", got, tt.want)
+			}
+			var aerr awserr.Error
+			if !errors.As(got, &aerr) {
+				t.Errorf("wrapError = %v, AWS error not reachable", got)
+			}
+		})
+	}
+	if wrapError(nil) != nil {
+		t.Error("wrapError(nil) != nil")
+	}
+}
@@ -0,0 +1,109 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ExpireAtMetadataKey is the user metadata key holding an object's expiry time in RFC 3339
+const ExpireAtMetadataKey = "Expire-At"
+
+// WithExpireAt marks the uploaded object for deletion by SweepExpiredObjects after t
+func WithExpireAt(t time.Time) UploadOption {
+	return WithUploadInput(func(in *s3manager.UploadInput) {
+		if in.Metadata == nil {
+			in.Metadata = make(map[string]*string)
+		}
+		in.Metadata[ExpireAtMetadataKey] = aws.String(t.UTC().Format(time.RFC3339))
+	})
+}
+
+// ExpirySweepReport summarizes the work done by SweepExpiredObjects
+type ExpirySweepReport struct {
+	Scanned int
+	Deleted []string
+
+	mu sync.Mutex
+}
+
+// expirySweepBatch is the number of listed objects checked at a time, one
+// listing page
+const expirySweepBatch = 1000
+
+// SweepExpiredObjects deletes every object under prefix whose expiry metadata
+// lies in the past. Expiry is not part of listings, so the objects are
+// walked a page at a time and each one is checked with a HEAD request using
+// up to concurrency workers. Deletes are sent with If-Match so an object
+// overwritten after the check is left alone.
+func SweepExpiredObjects(ctx context.Context, sess *session.Session, bucket, prefix string, concurrency int) (*ExpirySweepReport, error) {
+	svc := s3.New(sess)
+	report := &ExpirySweepReport{}
+	now := time.Now()
+	check := func(ctx context.Context, obj ObjectInfo) error {
+		head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(obj.Key),
+		})
+		if err = wrapError(err); errors.Is(err, ErrObjectNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		expireAt, err := time.Parse(time.RFC3339, aws.StringValue(head.Metadata[ExpireAtMetadataKey]))
+		if err != nil || expireAt.After(now) {
+			return nil
+		}
+
+		_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(obj.Key),
+		}, request.WithSetRequestHeaders(map[string]string{"If-Match": aws.StringValue(head.ETag)}))
+		if err != nil {
+			if isConditionalConflict(err) {
+				return nil
+			}
+			return wrapError(err)
+		}
+
+		report.mu.Lock()
+		report.Deleted = append(report.Deleted, obj.Key)
+		report.mu.Unlock()
+		return nil
+	}
+
+	var batch []ObjectInfo
+	var checkErr error
+	flush := func() bool {
+		checkErr = runParallel(ctx, concurrency, batch, check)
+		batch = batch[:0]
+		return checkErr == nil
+	}
+	err := WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		report.Scanned++
+		batch = append(batch, obj)
+		return len(batch) < expirySweepBatch || flush()
+	})
+	if err == nil && checkErr == nil && len(batch) > 0 {
+		flush()
+	}
+	if checkErr != nil {
+		return report, checkErr
+	}
+	return report, err
+}
+
+// ExpirySweep returns a JanitorTask running SweepExpiredObjects over prefix
+func ExpirySweep(prefix string, concurrency int) JanitorTask {
+	return func(ctx context.Context, sess *session.Session, bucket string) error {
+		_, err := SweepExpiredObjects(ctx, sess, bucket, prefix, concurrency)
+		return err
+	}
+}
@@ -0,0 +1,178 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// EndpointFailoverOptions tunes an EndpointFailover
+type EndpointFailoverOptions struct {
+	// Cooldown is how long a failed endpoint is skipped before it is
+	// health-checked again. Defaults to 30s.
+	Cooldown time.Duration
+	// ProbeTimeout bounds a single health check. Defaults to 2s.
+	ProbeTimeout time.Duration
+}
+
+// failoverEndpoint is one endpoint of an EndpointFailover
+type failoverEndpoint struct {
+	url       *url.URL
+	downUntil time.Time
+	down      bool
+	probing   bool
+}
+
+// EndpointFailover routes S3 requests to the first healthy endpoint of an
+// ordered list, for example an interface VPC endpoint followed by the public
+// regional endpoint. An endpoint that fails to connect or returns a 500,
+// 502 or 504 status is skipped for the cooldown and then health-checked in
+// the background; requests return to it once a check succeeds. Throttling,
+// such as 503 SlowDown, is not counted as a failure.
+type EndpointFailover struct {
+	opts   EndpointFailoverOptions
+	client *http.Client
+
+	mu        sync.Mutex
+	endpoints []*failoverEndpoint
+}
+
+// NewEndpointFailover creates an EndpointFailover over endpoints, most preferred first
+func NewEndpointFailover(endpoints []string, opts EndpointFailoverOptions) (*EndpointFailover, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("s3utils: at least one endpoint is required")
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 30 * time.Second
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = 2 * time.Second
+	}
+	f := &EndpointFailover{opts: opts, client: &http.Client{Timeout: opts.ProbeTimeout}}
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("s3utils: invalid endpoint %q", e)
+		}
+		f.endpoints = append(f.endpoints, &failoverEndpoint{url: u})
+	}
+	return f, nil
+}
+
+// Current returns the endpoint requests are currently sent to
+func (f *EndpointFailover) Current() string {
+	return f.pick().String()
+}
+
+// pick returns the most preferred healthy endpoint, starting health checks
+// for failed endpoints whose cooldown has passed. If every endpoint is down
+// the one that failed longest ago is used.
+func (f *EndpointFailover) pick() *url.URL {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	var fallback *failoverEndpoint
+	for _, e := range f.endpoints {
+		if !e.down {
+			return e.url
+		}
+		if !e.probing && now.After(e.downUntil) {
+			e.probing = true
+			go f.probe(e)
+		}
+		if fallback == nil || e.downUntil.Before(fallback.downUntil) {
+			fallback = e
+		}
+	}
+	return fallback.url
+}
+
+// probe health-checks a failed endpoint. Any HTTP response counts as
+// healthy since unauthenticated requests are rejected with 403.
+func (f *EndpointFailover) probe(e *failoverEndpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), f.opts.ProbeTimeout)
+	defer cancel()
+
+	healthy := false
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, e.url.String(), nil)
+	if err == nil {
+		if resp, err := f.client.Do(req); err == nil {
+			resp.Body.Close()
+			healthy = resp.StatusCode < 500
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e.probing = false
+	if healthy {
+		e.down = false
+	} else {
+		e.downUntil = time.Now().Add(f.opts.Cooldown)
+	}
+}
+
+// markDown records a failure of the endpoint serving host
+func (f *EndpointFailover) markDown(host string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.endpoints {
+		if e.url.Host == host && !e.down {
+			e.down = true
+			e.downUntil = time.Now().Add(f.opts.Cooldown)
+		}
+	}
+}
+
+// WithEndpointFailover sends every request to the endpoint selected by f.
+// Path-style addressing is enabled so bucket names never become part of
+// the endpoint host. Failures move retries to the next endpoint, so keep
+// the SDK MaxRetries at least as large as the number of endpoints.
+func WithEndpointFailover(f *EndpointFailover) ClientOption {
+	return func(c *Client) {
+		c.sess.Config.Endpoint = aws.String(f.endpoints[0].url.String())
+		c.sess.Config.S3ForcePathStyle = aws.Bool(true)
+		// Runs before every signing attempt, so retries are re-signed for the new host
+		c.sess.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+			Name: "s3utils.EndpointFailover",
+			Fn: func(r *request.Request) {
+				u := f.pick()
+				r.HTTPRequest.URL.Scheme = u.Scheme
+				r.HTTPRequest.URL.Host = u.Host
+				r.HTTPRequest.Host = ""
+			},
+		})
+		c.sess.Handlers.Retry.PushFrontNamed(request.NamedHandler{
+			Name: "s3utils.EndpointFailoverCheck",
+			Fn: func(r *request.Request) {
+				if isEndpointFailure(r) {
+					f.markDown(r.HTTPRequest.URL.Host)
+				}
+			},
+		})
+	}
+}
+
+// isEndpointFailure reports whether r failed because its endpoint is
+// unreachable or broken, rather than busy
+func isEndpointFailure(r *request.Request) bool {
+	if isAWSErrorCode(r.Error, request.ErrCodeRequestError) || isAWSErrorCode(r.Error, request.ErrCodeResponseTimeout) {
+		return true
+	}
+	if r.HTTPResponse == nil || isThrottled(r) {
+		return false
+	}
+	switch r.HTTPResponse.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package s3utils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// storageClassUnavailableCodes are the error codes that trigger a storage
+// class fallback. Generic codes such as ServiceUnavailable are left out, as
+// they say nothing about the class and are retried by the SDK.
+var storageClassUnavailableCodes = []string{
+	"InvalidStorageClass",
+}
+
+// WithStorageClassFallback retries an upload with the given storage classes,
+// in order, when the requested class is rejected. The class actually used is
+// reported by UploadResult.StorageClass and the original request by
+// UploadResult.RequestedStorageClass. The body must be seekable to be sent
+// again; otherwise the rejection is returned.
+func WithStorageClassFallback(classes ...string) UploadOption {
+	return func(c *uploadConfig) {
+		c.fallback = append(c.fallback, classes...)
+	}
+}
+
+// isStorageClassUnavailable reports whether err means the storage class cannot be used
+func isStorageClassUnavailable(err error) bool {
+	for _, code := range storageClassUnavailableCodes {
+		if isAWSErrorCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendWithFallback calls send and retries with the fallback storage classes
+// while the error indicates the class is unavailable. It returns the
+// originally requested class when a fallback was used.
+func (c *uploadConfig) sendWithFallback(send func() (*s3manager.UploadOutput, error)) (*s3manager.UploadOutput, string, error) {
+	requested := aws.StringValue(c.input.StorageClass)
+	out, err := send()
+	for _, class := range c.fallback {
+		if err == nil || !isStorageClassUnavailable(err) {
+			break
+		}
+		seeker, ok := c.input.Body.(io.Seeker)
+		if !ok {
+			return nil, "", fmt.Errorf("s3utils: cannot fall back to storage class %s, the body is not seekable: %w", class, err)
+		}
+		if _, serr := seeker.Seek(0, io.SeekStart); serr != nil {
+			return nil, "", fmt.Errorf("s3utils: cannot fall back to storage class %s: rewinding the body: %v: %w", class, serr, err)
+		}
+		c.input.StorageClass = aws.String(class)
+		out, err = send()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if aws.StringValue(c.input.StorageClass) == requested {
+		return out, "", nil
+	}
+	if requested == "" {
+		requested = s3.StorageClassStandard
+	}
+	return out, requested, nil
+}
@@ -0,0 +1,98 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// FindObjects returns the objects whose key matches the glob pattern.
+// "*" and "?" match within one path segment, "**" matches any number of
+// segments and "[...]" matches a character class. Only the literal prefix
+// before the first wildcard is listed, so "logs/2024/**/*.json.gz" never
+// lists outside logs/2024/.
+func FindObjects(ctx context.Context, sess *session.Session, bucket, pattern string) ([]ObjectInfo, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return findMatching(ctx, sess, bucket, globPrefix(pattern), re)
+}
+
+// FindObjectsRegexp returns the objects whose key matches re. When re is
+// anchored with ^, listing starts at its literal prefix; otherwise the whole
+// bucket is listed.
+func FindObjectsRegexp(ctx context.Context, sess *session.Session, bucket string, re *regexp.Regexp) ([]ObjectInfo, error) {
+	prefix := ""
+	if expr, ok := strings.CutPrefix(re.String(), "^"); ok {
+		if anchored, err := regexp.Compile(expr); err == nil {
+			prefix, _ = anchored.LiteralPrefix()
+		}
+	}
+	return findMatching(ctx, sess, bucket, prefix, re)
+}
+
+// findMatching lists prefix and keeps the keys matching re
+func findMatching(ctx context.Context, sess *session.Session, bucket, prefix string, re *regexp.Regexp) ([]ObjectInfo, error) {
+	var matches []ObjectInfo
+	err := WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		if re.MatchString(obj.Key) {
+			matches = append(matches, obj)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// globPrefix returns the literal part of pattern before its first wildcard
+func globPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?["); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// globRegexp converts a key glob pattern into an anchored regular expression
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				// Zero or more whole segments
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("s3utils: unterminated character class in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
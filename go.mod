@@ -2,6 +2,24 @@ module github.com/csmanutd/s3utils
 
 go 1.23.1
 
-require github.com/aws/aws-sdk-go v1.55.5
+require (
+	github.com/aws/aws-sdk-go v1.55.5
+	github.com/klauspost/compress v1.18.0
+	github.com/pierrec/lz4/v4 v4.1.22
+	go.opentelemetry.io/otel v1.32.0
+	go.opentelemetry.io/otel/trace v1.32.0
+	golang.org/x/image v0.24.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/text v0.22.0
+	google.golang.org/grpc v1.70.0
+)
 
-require github.com/jmespath/go-jmespath v0.4.0 // indirect
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	go.opentelemetry.io/otel/metric v1.32.0 // indirect
+	golang.org/x/net v0.32.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
+	google.golang.org/protobuf v1.35.2 // indirect
+)
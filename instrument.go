@@ -0,0 +1,71 @@
+package s3utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// OperationMetrics describes a single S3 operation once it has finished,
+// after any retries
+type OperationMetrics struct {
+	Operation string
+	Bucket    string
+	Key       string
+	// Bytes is the request payload size plus the response content length
+	Bytes      int64
+	Duration   time.Duration
+	Retries    int
+	StatusCode int
+	Err        error
+}
+
+// Instrumentation observes the S3 operations sent through a Client
+type Instrumentation interface {
+	// Start is called before an operation is sent. The returned context is
+	// used for the request, so tracing implementations can attach a span.
+	Start(ctx context.Context, operation string) context.Context
+	// End is called with the context returned by Start once the operation completes
+	End(ctx context.Context, m OperationMetrics)
+}
+
+// WithInstrumentation reports every S3 operation made through the Client to inst
+func WithInstrumentation(inst Instrumentation) ClientOption {
+	return func(c *Client) {
+		c.sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+			Name: "s3utils.InstrumentationStart",
+			Fn: func(r *request.Request) {
+				r.SetContext(inst.Start(r.Context(), r.Operation.Name))
+			},
+		})
+		c.sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+			Name: "s3utils.InstrumentationEnd",
+			Fn: func(r *request.Request) {
+				inst.End(r.Context(), operationMetrics(r))
+			},
+		})
+	}
+}
+
+// operationMetrics collects the metrics of a completed request
+func operationMetrics(r *request.Request) OperationMetrics {
+	m := OperationMetrics{
+		Operation: r.Operation.Name,
+		Bucket:    getStringParam(r.Params, "Bucket"),
+		Key:       getStringParam(r.Params, "Key"),
+		Duration:  time.Since(r.Time),
+		Retries:   r.RetryCount,
+		Err:       r.Error,
+	}
+	if r.HTTPRequest != nil && r.HTTPRequest.ContentLength > 0 {
+		m.Bytes += r.HTTPRequest.ContentLength
+	}
+	if r.HTTPResponse != nil {
+		m.StatusCode = r.HTTPResponse.StatusCode
+		if r.HTTPResponse.ContentLength > 0 {
+			m.Bytes += r.HTTPResponse.ContentLength
+		}
+	}
+	return m
+}
@@ -0,0 +1,71 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// JanitorTask is a single cleanup pass over a bucket run by a Janitor
+type JanitorTask func(ctx context.Context, sess *session.Session, bucket string) error
+
+type janitorTask struct {
+	name string
+	run  JanitorTask
+}
+
+// Janitor runs cleanup tasks against a bucket, once or on an interval
+type Janitor struct {
+	sess   *session.Session
+	bucket string
+	tasks  []janitorTask
+
+	// OnError is called when a task fails during Run. Failed tasks do not
+	// stop the remaining tasks or later passes.
+	OnError func(task string, err error)
+}
+
+// NewJanitor creates a Janitor for bucket with no tasks
+func NewJanitor(sess *session.Session, bucket string) *Janitor {
+	return &Janitor{sess: sess, bucket: bucket}
+}
+
+// Add registers a task under name. Tasks run in the order they were added.
+func (j *Janitor) Add(name string, task JanitorTask) *Janitor {
+	j.tasks = append(j.tasks, janitorTask{name: name, run: task})
+	return j
+}
+
+// RunOnce runs every task once and returns the joined task errors
+func (j *Janitor) RunOnce(ctx context.Context) error {
+	var errs []error
+	for _, t := range j.tasks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := t.run(ctx, j.sess, j.bucket); err != nil {
+			if j.OnError != nil {
+				j.OnError(t.name, err)
+			}
+			errs = append(errs, fmt.Errorf("s3utils: janitor task %s: %w", t.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run runs every task immediately and then every interval until ctx is done
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		j.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
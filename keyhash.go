@@ -0,0 +1,95 @@
+package s3utils
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// minKeyHashLen is the shortest hex segment treated as a content hash
+const minKeyHashLen = 6
+
+// keyHashAlgorithms are the digests WithKeyHashVerification accepts
+var keyHashAlgorithms = map[string]func() hash.Hash{
+	s3.ChecksumAlgorithmSha256: sha256.New,
+	s3.ChecksumAlgorithmSha1:   sha1.New,
+	"MD5":                      md5.New,
+}
+
+// KeyContentHash returns the content hash embedded in key by asset
+// fingerprinting, such as "3f9a1c" in "assets/app.3f9a1c.js": the last
+// dot-separated segment of the base name, other than the first and the
+// extension, made only of hex digits. It reports false when there is none.
+func KeyContentHash(key string) (string, bool) {
+	parts := strings.Split(path.Base(key), ".")
+	for i := len(parts) - 2; i >= 1; i-- {
+		if len(parts[i]) >= minKeyHashLen && isHex(parts[i]) {
+			return strings.ToLower(parts[i]), true
+		}
+	}
+	return "", false
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// WithKeyHashVerification checks the downloaded content against the hash
+// embedded in the key, as returned by KeyContentHash. The hash may be a
+// prefix of the full hex digest computed with algorithm, which is "SHA256",
+// "SHA1" or "MD5". A mismatch fails the download with a
+// *ChecksumMismatchError. Keys without an embedded hash are not checked.
+func WithKeyHashVerification(algorithm string) DownloadOption {
+	return func(c *downloadConfig) {
+		c.keyHash = strings.ToUpper(algorithm)
+	}
+}
+
+// keyHashVerifier hashes downloaded content for comparison with its key
+type keyHashVerifier struct {
+	hash.Hash
+	algorithm string
+	expected  string
+}
+
+// newKeyHashVerifier returns nil when key embeds no hash
+func newKeyHashVerifier(algorithm, key string) (*keyHashVerifier, error) {
+	newHash, ok := keyHashAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("s3utils: unsupported key hash algorithm %q", algorithm)
+	}
+	expected, ok := KeyContentHash(key)
+	if !ok {
+		return nil, nil
+	}
+	return &keyHashVerifier{Hash: newHash(), algorithm: algorithm, expected: expected}, nil
+}
+
+func (v *keyHashVerifier) verify(bucket, key string) error {
+	actual := hex.EncodeToString(v.Sum(nil))
+	if strings.HasPrefix(actual, v.expected) {
+		return nil
+	}
+	if len(v.expected) < len(actual) {
+		actual = actual[:len(v.expected)]
+	}
+	return &ChecksumMismatchError{
+		Bucket:    bucket,
+		Key:       key,
+		Algorithm: v.algorithm,
+		Expected:  v.expected,
+		Actual:    actual,
+	}
+}
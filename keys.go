@@ -0,0 +1,79 @@
+package s3utils
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// JoinKey joins key elements with "/". Unlike filepath.Join it never uses
+// the Windows separator, and elements holding local paths have theirs
+// converted. The result is cleaned like path.Join and has no leading slash.
+func JoinKey(elem ...string) string {
+	parts := make([]string, len(elem))
+	for i, e := range elem {
+		parts[i] = filepath.ToSlash(e)
+	}
+	key := strings.TrimLeft(path.Join(parts...), "/")
+	if key == "." {
+		return ""
+	}
+	return key
+}
+
+// NormalizeKey returns key with backslashes turned into slashes, repeated
+// slashes collapsed, "." and ".." segments resolved and any leading slash
+// removed. A trailing slash, which marks a folder, is kept.
+func NormalizeKey(key string) string {
+	folder := strings.HasSuffix(key, "/") || strings.HasSuffix(key, `\`)
+	key = JoinKey(strings.ReplaceAll(key, `\`, "/"))
+	if folder && key != "" {
+		key += "/"
+	}
+	return key
+}
+
+// SanitizeKey replaces every character S3 recommends avoiding in keys, the
+// ones rejected by NameRules.SafeKeys, with replacement
+func SanitizeKey(key, replacement string) string {
+	var b strings.Builder
+	for _, c := range key {
+		if isUnsafeKeyRune(c) {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// TruncateKey shortens key to at most max UTF-8 bytes by trimming the end of
+// its base name, keeping the folder and the extension. Zero uses
+// MaxKeyLength. Keys whose folder and extension alone exceed max are cut at
+// max bytes.
+func TruncateKey(key string, max int) string {
+	if max <= 0 {
+		max = MaxKeyLength
+	}
+	if len(key) <= max {
+		return key
+	}
+	dir, base := path.Split(key)
+	ext := path.Ext(base)
+	if keep := max - len(dir) - len(ext); keep > 0 {
+		return dir + truncateUTF8(strings.TrimSuffix(base, ext), keep) + ext
+	}
+	return truncateUTF8(key, max)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
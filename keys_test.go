@@ -0,0 +1,50 @@
+package s3utils
+
+import "testing"
+
+func TestJoinKey(t *testing.T) {
+	tests := []struct {
+		elem []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{""}, ""},
+		{[]string{"", ""}, ""},
+		{[]string{"a"}, "a"},
+		{[]string{"a", "b.txt"}, "a/b.txt"},
+		{[]string{"", "b.txt"}, "b.txt"},
+		{[]string{"a/", "/b.txt"}, "a/b.txt"},
+		{[]string{"/a", "b"}, "a/b"},
+		{[]string{"a//b", "c"}, "a/b/c"},
+		{[]string{"a/./b", "../c"}, "a/c"},
+		{[]string{"..", "a"}, "../a"},
+		{[]string{"/..", "a"}, "a"},
+		{[]string{"a", "b", "c/"}, "a/b/c"},
+		{[]string{"/"}, ""},
+		{[]string{"."}, ""},
+	}
+	for _, tt := range tests {
+		if got := JoinKey(tt.elem...); got != tt.want {
+			t.Errorf("JoinKey(%q) = %q, want %q", tt.elem, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeKey(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"", ""},
+		{"a/b.txt", "a/b.txt"},
+		{`a\b.txt`, "a/b.txt"},
+		{"/a//b/", "a/b/"},
+		{`a\b\`, "a/b/"},
+		{"a/./b/../c", "a/c"},
+		{"/", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeKey(tt.key); got != tt.want {
+			t.Errorf("NormalizeKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// LatestPointer is the content of a pointer object referencing the newest real key
+type LatestPointer struct {
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// WriteLatestPointer points the pointer object at bucket/pointerKey to targetKey.
+// The pointer is replaced with a conditional write so concurrent writers
+// cannot interleave, and it never moves back to a target older than the one
+// it already references.
+func WriteLatestPointer(ctx context.Context, sess *session.Session, bucket, pointerKey, targetKey string) (*LatestPointer, error) {
+	svc := s3.New(sess)
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(targetKey),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	next := &LatestPointer{
+		Key:          targetKey,
+		VersionID:    aws.StringValue(head.VersionId),
+		ETag:         aws.StringValue(head.ETag),
+		LastModified: aws.TimeValue(head.LastModified),
+	}
+
+	for attempt := 0; attempt < maxCounterAttempts; attempt++ {
+		current, etag, err := readLatestPointer(ctx, svc, bucket, pointerKey)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil && current.LastModified.After(next.LastModified) {
+			return current, nil
+		}
+
+		next.UpdatedAt = time.Now().UTC()
+		data, err := json.Marshal(next)
+		if err != nil {
+			return nil, err
+		}
+		header := map[string]string{"If-None-Match": "*"}
+		if etag != "" {
+			header = map[string]string{"If-Match": etag}
+		}
+		_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:       aws.String(bucket),
+			Key:          aws.String(pointerKey),
+			Body:         bytes.NewReader(data),
+			ContentType:  aws.String("application/json"),
+			CacheControl: aws.String("no-cache"),
+		}, request.WithSetRequestHeaders(header), internalWrite)
+		if err != nil {
+			if isConditionalConflict(err) {
+				continue
+			}
+			return nil, wrapError(err)
+		}
+		return next, nil
+	}
+	return nil, fmt.Errorf("s3utils: pointer %s is still contended after %d attempts", pointerKey, maxCounterAttempts)
+}
+
+// ResolveLatestPointer reads the pointer object at bucket/pointerKey.
+// It returns ErrObjectNotFound if the pointer has never been written.
+func ResolveLatestPointer(ctx context.Context, sess *session.Session, bucket, pointerKey string) (*LatestPointer, error) {
+	p, _, err := readLatestPointer(ctx, s3.New(sess), bucket, pointerKey)
+	if err == nil && p == nil {
+		err = &Error{Kind: ErrObjectNotFound, Err: fmt.Errorf("s3utils: pointer %s has not been written", pointerKey)}
+	}
+	return p, err
+}
+
+// readLatestPointer returns the current pointer and its ETag, or nil if it does not exist
+func readLatestPointer(ctx context.Context, svc *s3.S3, bucket, pointerKey string) (*LatestPointer, string, error) {
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(pointerKey),
+	})
+	if err != nil {
+		err = wrapError(err)
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+	defer out.Body.Close()
+
+	var p LatestPointer
+	if err := json.NewDecoder(out.Body).Decode(&p); err != nil {
+		return nil, "", err
+	}
+	return &p, aws.StringValue(out.ETag), nil
+}
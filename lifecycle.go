@@ -0,0 +1,205 @@
+package s3utils
+
+import (
+	"context"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// LifecycleRule is a simplified lifecycle rule scoped to a key prefix and,
+// optionally, to object tags and sizes. Zero-valued actions are omitted
+// from the rule.
+type LifecycleRule struct {
+	ID                                 string                `json:"id"`
+	Prefix                             string                `json:"prefix"`
+	Disabled                           bool                  `json:"disabled,omitempty"`
+	ExpirationDays                     int64                 `json:"expiration_days,omitempty"`
+	Transitions                        []LifecycleTransition `json:"transitions,omitempty"`
+	AbortIncompleteMultipartUploadDays int64                 `json:"abort_incomplete_multipart_upload_days,omitempty"`
+	// NoncurrentVersionExpirationDays deletes non-current versions on versioned buckets
+	NoncurrentVersionExpirationDays int64 `json:"noncurrent_version_expiration_days,omitempty"`
+	// ExpiredObjectDeleteMarker removes delete markers that have no remaining versions
+	ExpiredObjectDeleteMarker bool `json:"expired_object_delete_marker,omitempty"`
+	// Tags limits the rule to objects carrying all of these tags
+	Tags map[string]string `json:"tags,omitempty"`
+	// ObjectSizeGreaterThan and ObjectSizeLessThan limit the rule to objects
+	// whose size in bytes lies within the bounds. Zero means no bound.
+	ObjectSizeGreaterThan int64 `json:"object_size_greater_than,omitempty"`
+	ObjectSizeLessThan    int64 `json:"object_size_less_than,omitempty"`
+}
+
+// LifecycleTransition moves objects to StorageClass after Days
+type LifecycleTransition struct {
+	Days         int64  `json:"days"`
+	StorageClass string `json:"storage_class"`
+}
+
+// GetBucketLifecycle returns the lifecycle rules of bucket, or nil if none are configured
+func GetBucketLifecycle(ctx context.Context, sess *session.Session, bucket string) ([]LifecycleRule, error) {
+	return getLifecycleRules(ctx, s3.New(sess), bucket)
+}
+
+// PutBucketLifecycle replaces the lifecycle rules of bucket.
+// An empty rule set deletes the lifecycle configuration.
+func PutBucketLifecycle(ctx context.Context, sess *session.Session, bucket string, rules []LifecycleRule) error {
+	svc := s3.New(sess)
+	if len(rules) == 0 {
+		_, err := svc.DeleteBucketLifecycleWithContext(ctx, &s3.DeleteBucketLifecycleInput{Bucket: aws.String(bucket)})
+		return wrapError(err)
+	}
+	return putLifecycleRules(ctx, svc, bucket, rules)
+}
+
+// getLifecycleRules reads the lifecycle configuration of bucket
+func getLifecycleRules(ctx context.Context, svc *s3.S3, bucket string) ([]LifecycleRule, error) {
+	out, err := svc.GetBucketLifecycleConfigurationWithContext(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, ignoreCodes(err, "NoSuchLifecycleConfiguration")
+	}
+
+	var rules []LifecycleRule
+	for _, r := range out.Rules {
+		rule := LifecycleRule{
+			ID:       aws.StringValue(r.ID),
+			Disabled: aws.StringValue(r.Status) == s3.ExpirationStatusDisabled,
+		}
+		if r.Filter != nil {
+			rule.setFilter(r.Filter)
+		} else {
+			rule.Prefix = aws.StringValue(r.Prefix)
+		}
+		if r.Expiration != nil {
+			rule.ExpirationDays = aws.Int64Value(r.Expiration.Days)
+			rule.ExpiredObjectDeleteMarker = aws.BoolValue(r.Expiration.ExpiredObjectDeleteMarker)
+		}
+		if r.NoncurrentVersionExpiration != nil {
+			rule.NoncurrentVersionExpirationDays = aws.Int64Value(r.NoncurrentVersionExpiration.NoncurrentDays)
+		}
+		for _, t := range r.Transitions {
+			rule.Transitions = append(rule.Transitions, LifecycleTransition{
+				Days:         aws.Int64Value(t.Days),
+				StorageClass: aws.StringValue(t.StorageClass),
+			})
+		}
+		if r.AbortIncompleteMultipartUpload != nil {
+			rule.AbortIncompleteMultipartUploadDays = aws.Int64Value(r.AbortIncompleteMultipartUpload.DaysAfterInitiation)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// putLifecycleRules replaces the lifecycle configuration of bucket
+func putLifecycleRules(ctx context.Context, svc *s3.S3, bucket string, rules []LifecycleRule) error {
+	var sdkRules []*s3.LifecycleRule
+	for _, r := range rules {
+		status := s3.ExpirationStatusEnabled
+		if r.Disabled {
+			status = s3.ExpirationStatusDisabled
+		}
+		rule := &s3.LifecycleRule{
+			ID:     aws.String(r.ID),
+			Status: aws.String(status),
+			Filter: r.filter(),
+		}
+		if r.ExpirationDays > 0 {
+			rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(r.ExpirationDays)}
+		} else if r.ExpiredObjectDeleteMarker {
+			rule.Expiration = &s3.LifecycleExpiration{ExpiredObjectDeleteMarker: aws.Bool(true)}
+		}
+		if r.NoncurrentVersionExpirationDays > 0 {
+			rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{
+				NoncurrentDays: aws.Int64(r.NoncurrentVersionExpirationDays),
+			}
+		}
+		for _, t := range r.Transitions {
+			rule.Transitions = append(rule.Transitions, &s3.Transition{
+				Days:         aws.Int64(t.Days),
+				StorageClass: aws.String(t.StorageClass),
+			})
+		}
+		if r.AbortIncompleteMultipartUploadDays > 0 {
+			rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{
+				DaysAfterInitiation: aws.Int64(r.AbortIncompleteMultipartUploadDays),
+			}
+		}
+		sdkRules = append(sdkRules, rule)
+	}
+
+	_, err := svc.PutBucketLifecycleConfigurationWithContext(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: sdkRules},
+	})
+	return wrapError(err)
+}
+
+// setFilter copies the prefix, tag and size conditions of f into the rule
+func (r *LifecycleRule) setFilter(f *s3.LifecycleRuleFilter) {
+	r.Prefix = aws.StringValue(f.Prefix)
+	r.ObjectSizeGreaterThan = aws.Int64Value(f.ObjectSizeGreaterThan)
+	r.ObjectSizeLessThan = aws.Int64Value(f.ObjectSizeLessThan)
+	tags := []*s3.Tag{f.Tag}
+	if f.And != nil {
+		r.Prefix = aws.StringValue(f.And.Prefix)
+		r.ObjectSizeGreaterThan = aws.Int64Value(f.And.ObjectSizeGreaterThan)
+		r.ObjectSizeLessThan = aws.Int64Value(f.And.ObjectSizeLessThan)
+		tags = f.And.Tags
+	}
+	for _, t := range tags {
+		if t == nil {
+			continue
+		}
+		if r.Tags == nil {
+			r.Tags = make(map[string]string)
+		}
+		r.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+}
+
+// filter returns the S3 filter of the rule. S3 takes a single condition
+// directly and several only combined with And.
+func (r LifecycleRule) filter() *s3.LifecycleRuleFilter {
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]*s3.Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, &s3.Tag{Key: aws.String(k), Value: aws.String(r.Tags[k])})
+	}
+	var greater, less *int64
+	conditions := len(tags)
+	if r.Prefix != "" {
+		conditions++
+	}
+	if r.ObjectSizeGreaterThan > 0 {
+		greater = aws.Int64(r.ObjectSizeGreaterThan)
+		conditions++
+	}
+	if r.ObjectSizeLessThan > 0 {
+		less = aws.Int64(r.ObjectSizeLessThan)
+		conditions++
+	}
+
+	switch {
+	case conditions > 1:
+		and := &s3.LifecycleRuleAndOperator{
+			ObjectSizeGreaterThan: greater,
+			ObjectSizeLessThan:    less,
+			Tags:                  tags,
+		}
+		if r.Prefix != "" {
+			and.Prefix = aws.String(r.Prefix)
+		}
+		return &s3.LifecycleRuleFilter{And: and}
+	case len(tags) == 1:
+		return &s3.LifecycleRuleFilter{Tag: tags[0]}
+	case greater != nil || less != nil:
+		return &s3.LifecycleRuleFilter{ObjectSizeGreaterThan: greater, ObjectSizeLessThan: less}
+	}
+	return &s3.LifecycleRuleFilter{Prefix: aws.String(r.Prefix)}
+}
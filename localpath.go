@@ -0,0 +1,153 @@
+package s3utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// LocalPathRules control how object keys are turned into local file names by
+// SyncFromS3 and DownloadPrefix. Keys are split on "/" and each segment that
+// cannot be used as a file name has the offending characters rewritten by
+// Escape. Segments "." and ".." are always escaped so no key can land outside
+// the target directory, and empty segments are dropped.
+type LocalPathRules struct {
+	// Windows applies the Windows file name rules: the characters <>:"/\|?*
+	// and ASCII control characters are escaped, as are trailing dots and
+	// spaces, and reserved device names such as CON or LPT1 get their last
+	// character escaped. Long paths get the \\?\ prefix when running on Windows.
+	Windows bool
+	// Escape returns the replacement for a character that cannot appear in a
+	// file name. Nil uses EscapePercent.
+	Escape func(c rune) string
+}
+
+// DefaultLocalPathRules are the rules used by DownloadPrefix and by syncs
+// without SyncOptions.LocalPaths. They apply the Windows rules only when
+// running on Windows.
+var DefaultLocalPathRules = LocalPathRules{Windows: runtime.GOOS == "windows"}
+
+// EscapePercent escapes c as "%XX" for each of its UTF-8 bytes, so "a:b"
+// becomes "a%3Ab"
+func EscapePercent(c rune) string {
+	var b strings.Builder
+	for _, x := range []byte(string(c)) {
+		fmt.Fprintf(&b, "%%%02X", x)
+	}
+	return b.String()
+}
+
+// EscapeWith returns an Escape function replacing every character with s.
+// Distinct keys may then map to the same local path, which syncs report as an
+// error.
+func EscapeWith(s string) func(c rune) string {
+	return func(rune) string { return s }
+}
+
+// windowsReserved are the names Windows resolves to devices in any directory
+// and with any extension
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// windowsMaxPath is the longest path, including a directory's room for an
+// 8.3 file name, that Windows APIs accept without the \\?\ prefix
+const windowsMaxPath = 248
+
+// RelPath returns the slash-separated local path for rel, a key relative to
+// the sync or download prefix
+func (r LocalPathRules) RelPath(rel string) string {
+	segments := strings.Split(rel, "/")
+	out := segments[:0]
+	for _, seg := range segments {
+		if seg != "" {
+			out = append(out, r.segment(seg))
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// LocalPath returns the file below root that the key rel is stored in
+func (r LocalPathRules) LocalPath(root, rel string) string {
+	p := filepath.Join(root, filepath.FromSlash(r.RelPath(rel)))
+	if runtime.GOOS == "windows" && r.Windows {
+		p = windowsLongPath(p)
+	}
+	return p
+}
+
+// localPaths maps each key of remote, relative to the sync or download
+// prefix, to its slash-separated local path. Keys that escape to the same
+// local path are reported as an error instead of overwriting each other.
+func (r LocalPathRules) localPaths(remote map[string]ObjectInfo) (map[string]string, error) {
+	paths := make(map[string]string, len(remote))
+	owners := make(map[string]string, len(remote))
+	for rel, obj := range remote {
+		local := r.RelPath(rel)
+		if other, ok := owners[local]; ok {
+			return nil, fmt.Errorf("s3utils: keys %s and %s map to the same local path %s", other, obj.Key, local)
+		}
+		owners[local] = obj.Key
+		paths[rel] = local
+	}
+	return paths, nil
+}
+
+func (r LocalPathRules) segment(seg string) string {
+	escape := r.Escape
+	if escape == nil {
+		escape = EscapePercent
+	}
+	if seg == "." || seg == ".." {
+		return strings.Repeat(escape('.'), len(seg))
+	}
+	if !r.Windows {
+		return seg
+	}
+
+	runes := []rune(seg)
+	bad := make([]bool, len(runes))
+	for i, c := range runes {
+		bad[i] = c < 0x20 || strings.ContainsRune(`<>:"/\|?*`, c)
+	}
+	for i := len(runes) - 1; i >= 0 && (runes[i] == '.' || runes[i] == ' '); i-- {
+		bad[i] = true
+	}
+	stem, _, _ := strings.Cut(seg, ".")
+	stem = strings.TrimRight(stem, " ")
+	if windowsReserved[strings.ToUpper(stem)] {
+		bad[len(stem)-1] = true
+	}
+
+	var b strings.Builder
+	for i, c := range runes {
+		if bad[i] {
+			b.WriteString(escape(c))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// windowsLongPath adds the \\?\ prefix to p once it is too long for the
+// classic Windows APIs, making it absolute first since the prefix disables
+// relative path resolution
+func windowsLongPath(p string) string {
+	if len(p) < windowsMaxPath || strings.HasPrefix(p, `\\?\`) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,217 @@
+package s3utils
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ManifestFormat is the output format of GenerateManifest
+type ManifestFormat string
+
+// Supported manifest formats
+const (
+	ManifestCSV  ManifestFormat = "csv"
+	ManifestJSON ManifestFormat = "json"
+	// ManifestJSONL writes one JSON object per line, as Athena and other
+	// line-oriented readers expect
+	ManifestJSONL ManifestFormat = "jsonl"
+	// ManifestParquet writes a Snappy-compressed Parquet file with the
+	// columns key, size, etag, storage_class and last_modified, the last as
+	// a millisecond timestamp
+	ManifestParquet ManifestFormat = "parquet"
+)
+
+// manifestEntry is the JSON form of a manifest line. ETags are written
+// without quotes, as in S3 Inventory reports.
+type manifestEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	StorageClass string    `json:"storage_class"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// manifestWriter encodes listed objects one at a time
+type manifestWriter interface {
+	write(ObjectInfo) error
+	close() error
+}
+
+func newManifestWriter(format ManifestFormat, w io.Writer) (manifestWriter, error) {
+	switch format {
+	case ManifestCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"key", "size", "etag", "storage_class", "last_modified"}); err != nil {
+			return nil, err
+		}
+		return &csvManifest{w: cw}, nil
+	case ManifestJSON:
+		if _, err := io.WriteString(w, "["); err != nil {
+			return nil, err
+		}
+		return &jsonManifest{w: w}, nil
+	case ManifestJSONL:
+		return &jsonManifest{w: w, lines: true}, nil
+	case ManifestParquet:
+		return newParquetManifest(w)
+	}
+	return nil, fmt.Errorf("s3utils: unsupported manifest format %q", format)
+}
+
+type csvManifest struct {
+	w *csv.Writer
+}
+
+func (m *csvManifest) write(obj ObjectInfo) error {
+	return m.w.Write([]string{
+		obj.Key,
+		strconv.FormatInt(obj.Size, 10),
+		strings.Trim(obj.ETag, `"`),
+		obj.StorageClass,
+		obj.LastModified.UTC().Format(time.RFC3339),
+	})
+}
+
+func (m *csvManifest) close() error {
+	m.w.Flush()
+	return m.w.Error()
+}
+
+// jsonManifest streams a JSON array, or JSON lines when lines is set,
+// without holding it in memory
+type jsonManifest struct {
+	w     io.Writer
+	lines bool
+	count int
+}
+
+func (m *jsonManifest) write(obj ObjectInfo) error {
+	entry := manifestEntry(obj)
+	entry.ETag = strings.Trim(entry.ETag, `"`)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if m.lines {
+		_, err = io.WriteString(m.w, string(data)+"\n")
+		return err
+	}
+	sep := ",\n"
+	if m.count == 0 {
+		sep = "\n"
+	}
+	m.count++
+	_, err = io.WriteString(m.w, sep+string(data))
+	return err
+}
+
+func (m *jsonManifest) close() error {
+	if m.lines {
+		return nil
+	}
+	_, err := io.WriteString(m.w, "\n]\n")
+	return err
+}
+
+// GenerateManifest lists every object under prefix and writes its key, size,
+// ETag, storage class and last modified time to w in format. Objects are
+// written as they are listed, so memory use does not grow with the prefix.
+// It returns the number of objects written.
+func GenerateManifest(ctx context.Context, sess *session.Session, bucket, prefix string, format ManifestFormat, w io.Writer) (int, error) {
+	mw, err := newManifestWriter(format, w)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	var writeErr error
+	err = WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		if writeErr = mw.write(obj); writeErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if writeErr != nil {
+		return n, writeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, mw.close()
+}
+
+// GenerateManifestToS3 writes the manifest of bucket/prefix to dstBucket/dstKey,
+// streaming it into the upload as it is generated
+func GenerateManifestToS3(ctx context.Context, sess *session.Session, bucket, prefix string, format ManifestFormat, dstBucket, dstKey string, opts ...UploadOption) (int, error) {
+	pr, pw := io.Pipe()
+	var n int
+	go func() {
+		var err error
+		n, err = GenerateManifest(ctx, sess, bucket, prefix, format, pw)
+		pw.CloseWithError(err)
+	}()
+
+	cfg := newUploadConfig(dstBucket, dstKey, pr, opts)
+	if cfg.input.ContentType == nil {
+		cfg.input.ContentType = aws.String(manifestContentType(format))
+	}
+	if _, err := cfg.upload(ctx, sess); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ExportListing writes a compressed listing of bucket/prefix to
+// bucket/destKey in format, for querying very large prefixes with Athena.
+// The listing is compressed and uploaded as it is generated, so it is never
+// held in memory. Use ManifestParquet, ManifestJSONL or ManifestCSV; text
+// formats are gzip-compressed, and Athena needs skip.header.line.count set
+// to 1 to read the CSV header.
+func ExportListing(ctx context.Context, sess *session.Session, bucket, prefix, destKey string, format ManifestFormat, opts ...UploadOption) (int, error) {
+	if format == ManifestParquet {
+		// Parquet compresses its pages itself
+		return GenerateManifestToS3(ctx, sess, bucket, prefix, format, bucket, destKey, opts...)
+	}
+	pr, pw := io.Pipe()
+	var n int
+	go func() {
+		gz := gzip.NewWriter(pw)
+		var err error
+		n, err = GenerateManifest(ctx, sess, bucket, prefix, format, gz)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	cfg := newUploadConfig(bucket, destKey, pr, opts)
+	if cfg.input.ContentType == nil {
+		cfg.input.ContentType = aws.String("application/gzip")
+	}
+	if _, err := cfg.upload(ctx, sess); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func manifestContentType(format ManifestFormat) string {
+	switch format {
+	case ManifestJSON:
+		return "application/json"
+	case ManifestJSONL:
+		return "application/x-ndjson"
+	case ManifestParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv"
+}
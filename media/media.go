@@ -0,0 +1,167 @@
+// Package media provides image helpers built on top of s3utils, such as
+// generating thumbnail renditions when an image is uploaded.
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif" // register GIF decoding
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/csmanutd/s3utils"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoding
+)
+
+// Supported rendition output formats
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// Rendition describes a derived image generated on upload
+type Rendition struct {
+	// Name is appended to the original key to form the rendition key, e.g. "thumb"
+	Name string
+	// MaxWidth and MaxHeight bound the rendition size; the aspect ratio is kept.
+	// A zero value leaves that dimension unconstrained.
+	MaxWidth  int
+	MaxHeight int
+	// Format is FormatJPEG or FormatPNG. Empty keeps the source format when
+	// it can be encoded and falls back to JPEG otherwise.
+	Format string
+	// Quality is the JPEG quality, 1-100. Zero uses jpeg.DefaultQuality.
+	Quality int
+}
+
+// UploadResult lists the keys written by UploadImage
+type UploadResult struct {
+	Key        string
+	Renditions map[string]string
+}
+
+// Keys returns the original key followed by all rendition keys
+func (r *UploadResult) Keys() []string {
+	keys := []string{r.Key}
+	for _, k := range r.Renditions {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// DerivedKey returns the key a rendition of key is stored under,
+// e.g. photos/cat.png with rendition "thumb" becomes photos/cat_thumb.jpg.
+func DerivedKey(key string, r Rendition, format string) string {
+	ext := path.Ext(key)
+	base := strings.TrimSuffix(key, ext)
+	switch format {
+	case FormatPNG:
+		ext = ".png"
+	default:
+		ext = ".jpg"
+	}
+	return base + "_" + r.Name + ext
+}
+
+// UploadImage uploads an image file and stores every configured rendition
+// next to it. The returned result holds the original and all derived keys.
+func UploadImage(ctx context.Context, sess *session.Session, fileName, bucket, folder string, renditions []Rendition, opts ...s3utils.UploadOption) (*UploadResult, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	src, srcFormat, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("media: decode %s: %w", fileName, err)
+	}
+
+	key, err := s3utils.UploadFile(ctx, sess, fileName, bucket, folder, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UploadResult{Key: key, Renditions: make(map[string]string)}
+	for _, r := range renditions {
+		format := r.Format
+		if format == "" {
+			format = srcFormat
+		}
+		if format != FormatPNG {
+			format = FormatJPEG
+		}
+
+		data, err := render(src, r, format)
+		if err != nil {
+			return result, err
+		}
+
+		// Renditions get the caller's options; only the content type differs
+		contentType := s3utils.WithUploadInput(func(in *s3manager.UploadInput) {
+			in.ContentType = aws.String("image/" + format)
+		})
+		derived, err := s3utils.UploadReader(ctx, sess, bucket, DerivedKey(key, r, format), bytes.NewReader(data), append(opts[:len(opts):len(opts)], contentType)...)
+		if err != nil {
+			return result, err
+		}
+		result.Renditions[r.Name] = derived.Key
+	}
+	return result, nil
+}
+
+// render scales src to fit the rendition bounds and encodes it
+func render(src image.Image, r Rendition, format string) ([]byte, error) {
+	w, h := fit(src.Bounds().Dx(), src.Bounds().Dy(), r.MaxWidth, r.MaxHeight)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if format != FormatPNG {
+		// JPEG has no alpha, so transparent areas would come out black
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatPNG:
+		err = png.Encode(&buf, dst)
+	default:
+		quality := r.Quality
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fit returns the largest size within maxW x maxH that keeps the aspect ratio of w x h.
+// Images are never scaled up.
+func fit(w, h, maxW, maxH int) (int, int) {
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && float64(h)*scale > float64(maxH) {
+		scale = float64(maxH) / float64(h)
+	}
+	nw, nh := int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	return nw, nh
+}
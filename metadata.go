@@ -0,0 +1,191 @@
+package s3utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// metadataBatchSize is the number of objects exported or imported per parallel batch
+const metadataBatchSize = 1000
+
+// MetadataRecord is one line of a metadata export
+type MetadataRecord struct {
+	Key                string            `json:"key"`
+	StorageClass       string            `json:"storage_class,omitempty"`
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	Tags               map[string]string `json:"tags,omitempty"`
+}
+
+// ExportMetadata writes a JSON line with the metadata, tags and storage class
+// of every object under prefix to w and returns the number of records written.
+// Objects are inspected with up to concurrency workers; records keep listing order.
+func ExportMetadata(ctx context.Context, sess *session.Session, bucket, prefix string, w io.Writer, concurrency int) (int, error) {
+	svc := s3.New(sess)
+	enc := json.NewEncoder(w)
+	written := 0
+
+	var batch []string
+	flush := func() error {
+		records := make([]MetadataRecord, len(batch))
+		indexes := make([]int, len(batch))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		err := runParallel(ctx, concurrency, indexes, func(ctx context.Context, i int) error {
+			rec, err := objectMetadata(ctx, svc, bucket, batch[i])
+			records[i] = rec
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+			written++
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	var flushErr error
+	err := WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		batch = append(batch, obj.Key)
+		if len(batch) == metadataBatchSize {
+			flushErr = flush()
+		}
+		return flushErr == nil
+	})
+	if flushErr != nil {
+		return written, flushErr
+	}
+	if err != nil {
+		return written, err
+	}
+	if len(batch) > 0 {
+		err = flush()
+	}
+	return written, err
+}
+
+// objectMetadata reads the metadata record of a single object
+func objectMetadata(ctx context.Context, svc *s3.S3, bucket, key string) (MetadataRecord, error) {
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return MetadataRecord{}, wrapError(err)
+	}
+	tagging, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return MetadataRecord{}, wrapError(err)
+	}
+
+	rec := MetadataRecord{
+		Key:                key,
+		StorageClass:       aws.StringValue(head.StorageClass),
+		ContentType:        aws.StringValue(head.ContentType),
+		ContentEncoding:    aws.StringValue(head.ContentEncoding),
+		ContentDisposition: aws.StringValue(head.ContentDisposition),
+		CacheControl:       aws.StringValue(head.CacheControl),
+	}
+	if len(head.Metadata) > 0 {
+		rec.Metadata = aws.StringValueMap(head.Metadata)
+	}
+	if len(tagging.TagSet) > 0 {
+		rec.Tags = make(map[string]string, len(tagging.TagSet))
+		for _, t := range tagging.TagSet {
+			rec.Tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+		}
+	}
+	return rec, nil
+}
+
+// ImportMetadata reapplies records written by ExportMetadata to the objects
+// of the same keys in bucket. Each object is copied onto itself with the
+// recorded metadata and storage class, then its tag set is replaced.
+// It returns the number of objects updated.
+func ImportMetadata(ctx context.Context, sess *session.Session, bucket string, r io.Reader, concurrency int) (int, error) {
+	svc := s3.New(sess)
+	dec := json.NewDecoder(bufio.NewReader(r))
+	imported := 0
+
+	for {
+		var batch []MetadataRecord
+		for len(batch) < metadataBatchSize {
+			var rec MetadataRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				break
+			} else if err != nil {
+				return imported, fmt.Errorf("s3utils: invalid metadata record: %w", err)
+			}
+			batch = append(batch, rec)
+		}
+		if len(batch) == 0 {
+			return imported, nil
+		}
+
+		err := runParallel(ctx, concurrency, batch, func(ctx context.Context, rec MetadataRecord) error {
+			return applyMetadata(ctx, svc, bucket, rec)
+		})
+		if err != nil {
+			return imported, err
+		}
+		imported += len(batch)
+	}
+}
+
+// applyMetadata updates a single object to match rec
+func applyMetadata(ctx context.Context, svc *s3.S3, bucket string, rec MetadataRecord) error {
+	in := &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(rec.Key),
+		MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+		Metadata:          aws.StringMap(rec.Metadata),
+	}
+	if rec.StorageClass != "" {
+		in.StorageClass = aws.String(rec.StorageClass)
+	}
+	if rec.ContentType != "" {
+		in.ContentType = aws.String(rec.ContentType)
+	}
+	if rec.ContentEncoding != "" {
+		in.ContentEncoding = aws.String(rec.ContentEncoding)
+	}
+	if rec.ContentDisposition != "" {
+		in.ContentDisposition = aws.String(rec.ContentDisposition)
+	}
+	if rec.CacheControl != "" {
+		in.CacheControl = aws.String(rec.CacheControl)
+	}
+	if err := copyObject(ctx, svc, bucket, rec.Key, in); err != nil {
+		return err
+	}
+
+	tags := make([]*s3.Tag, 0, len(rec.Tags))
+	for k, v := range rec.Tags {
+		tags = append(tags, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err := svc.PutObjectTaggingWithContext(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(rec.Key),
+		Tagging: &s3.Tagging{TagSet: tags},
+	})
+	return wrapError(err)
+}
@@ -0,0 +1,151 @@
+package s3utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RequestCategory groups S3 operations by how they are billed
+type RequestCategory string
+
+// Request categories tracked by RequestMetrics
+const (
+	RequestList   RequestCategory = "LIST"
+	RequestGet    RequestCategory = "GET"
+	RequestHead   RequestCategory = "HEAD"
+	RequestPut    RequestCategory = "PUT"
+	RequestCopy   RequestCategory = "COPY"
+	RequestDelete RequestCategory = "DELETE"
+	RequestOther  RequestCategory = "OTHER"
+)
+
+// categorize maps an S3 operation name onto its billing category
+func categorize(op string) RequestCategory {
+	switch {
+	case strings.HasPrefix(op, "List"):
+		return RequestList
+	case op == "HeadObject" || op == "HeadBucket":
+		return RequestHead
+	case op == "CopyObject" || op == "UploadPartCopy":
+		return RequestCopy
+	case strings.HasPrefix(op, "Delete"):
+		return RequestDelete
+	case strings.HasPrefix(op, "Get") || op == "SelectObjectContent":
+		return RequestGet
+	case strings.HasPrefix(op, "Put") || op == "UploadPart" || op == "CreateMultipartUpload" ||
+		op == "CompleteMultipartUpload" || op == "RestoreObject":
+		return RequestPut
+	}
+	return RequestOther
+}
+
+// RequestMetrics counts the S3 requests sent through a Client, including retries
+type RequestMetrics struct {
+	mu   sync.Mutex
+	byOp map[string]int64
+}
+
+func newRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{byOp: make(map[string]int64)}
+}
+
+func (m *RequestMetrics) add(op string) {
+	m.mu.Lock()
+	m.byOp[op]++
+	m.mu.Unlock()
+}
+
+// ByOperation returns the request count per S3 operation name
+func (m *RequestMetrics) ByOperation() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int64, len(m.byOp))
+	for op, n := range m.byOp {
+		counts[op] = n
+	}
+	return counts
+}
+
+// ByCategory returns the request count per billing category
+func (m *RequestMetrics) ByCategory() map[RequestCategory]int64 {
+	counts := make(map[RequestCategory]int64)
+	for op, n := range m.ByOperation() {
+		counts[categorize(op)] += n
+	}
+	return counts
+}
+
+// Reset clears all counters
+func (m *RequestMetrics) Reset() {
+	m.mu.Lock()
+	m.byOp = make(map[string]int64)
+	m.mu.Unlock()
+}
+
+// BudgetExceeded is passed to a RequestBudget hook the first time its limit is crossed
+type BudgetExceeded struct {
+	Name  string
+	Limit int64
+	Count int64
+	// Operation is the S3 operation that crossed the limit
+	Operation string
+}
+
+// RequestBudget caps the number of requests a single logical operation
+// (for example one sync) is expected to make
+type RequestBudget struct {
+	Name       string
+	Limit      int64
+	OnExceeded func(BudgetExceeded)
+
+	count    atomic.Int64
+	exceeded atomic.Bool
+}
+
+// Count returns the number of requests charged to the budget so far
+func (b *RequestBudget) Count() int64 {
+	return b.count.Load()
+}
+
+func (b *RequestBudget) charge(op string) {
+	n := b.count.Add(1)
+	if n > b.Limit && b.exceeded.CompareAndSwap(false, true) && b.OnExceeded != nil {
+		b.OnExceeded(BudgetExceeded{Name: b.Name, Limit: b.Limit, Count: n, Operation: op})
+	}
+}
+
+type budgetKey struct{}
+
+// WithRequestBudget charges every request made with the returned context,
+// through a Client session, to budget. Budgets nest: a request is charged
+// to every budget attached to its context.
+func WithRequestBudget(ctx context.Context, budget *RequestBudget) context.Context {
+	parent, _ := ctx.Value(budgetKey{}).([]*RequestBudget)
+	budgets := append(append([]*RequestBudget(nil), parent...), budget)
+	return context.WithValue(ctx, budgetKey{}, budgets)
+}
+
+// Metrics returns the request counters of the client
+func (c *Client) Metrics() *RequestMetrics {
+	return c.metrics
+}
+
+// countRequestHandler records each sent request in m and the budgets of its context
+func countRequestHandler(m *RequestMetrics) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "s3utils.CountRequests",
+		Fn: func(r *request.Request) {
+			op := r.Operation.Name
+			m.add(op)
+			if budgets, ok := r.Context().Value(budgetKey{}).([]*RequestBudget); ok {
+				for _, b := range budgets {
+					b.charge(op)
+				}
+			}
+		},
+	}
+}
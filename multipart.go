@@ -0,0 +1,121 @@
+package s3utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MultipartUpload describes a multipart upload that was started but not completed
+type MultipartUpload struct {
+	Key          string
+	UploadID     string
+	StorageClass string
+	Initiated    time.Time
+}
+
+// MultipartCleanupReport summarizes the work done by AbortStaleMultipartUploads
+type MultipartCleanupReport struct {
+	// Aborted lists the uploads that were aborted
+	Aborted []MultipartUpload
+	// Parts is the number of uploaded parts that were discarded
+	Parts int
+	// Bytes is the total size of the discarded parts
+	Bytes int64
+}
+
+// ListIncompleteMultipartUploads lists the multipart uploads in progress under prefix
+func ListIncompleteMultipartUploads(ctx context.Context, sess *session.Session, bucket, prefix string) ([]MultipartUpload, error) {
+	return listMultipartUploads(ctx, s3.New(sess), bucket, prefix)
+}
+
+func listMultipartUploads(ctx context.Context, svc *s3.S3, bucket, prefix string) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+	err := svc.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+		for _, u := range page.Uploads {
+			uploads = append(uploads, MultipartUpload{
+				Key:          aws.StringValue(u.Key),
+				UploadID:     aws.StringValue(u.UploadId),
+				StorageClass: aws.StringValue(u.StorageClass),
+				Initiated:    aws.TimeValue(u.Initiated),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return uploads, nil
+}
+
+// AbortStaleMultipartUploads aborts every multipart upload in bucket that was
+// initiated more than olderThan ago. The uploaded parts are listed before
+// aborting so the report shows how much storage was freed.
+func AbortStaleMultipartUploads(ctx context.Context, sess *session.Session, bucket string, olderThan time.Duration) (*MultipartCleanupReport, error) {
+	svc := s3.New(sess)
+	uploads, err := listMultipartUploads(ctx, svc, bucket, "")
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MultipartCleanupReport{}
+	cutoff := time.Now().Add(-olderThan)
+	for _, u := range uploads {
+		if !u.Initiated.Before(cutoff) {
+			continue
+		}
+		parts, size, err := uploadedParts(ctx, svc, bucket, u)
+		if err != nil {
+			return report, err
+		}
+		_, err = svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(u.Key),
+			UploadId: aws.String(u.UploadID),
+		})
+		if err != nil && !isAWSErrorCode(err, s3.ErrCodeNoSuchUpload) {
+			return report, wrapError(err)
+		}
+		report.Aborted = append(report.Aborted, u)
+		report.Parts += parts
+		report.Bytes += size
+	}
+	return report, nil
+}
+
+// uploadedParts returns the number and total size of the parts uploaded so far
+func uploadedParts(ctx context.Context, svc *s3.S3, bucket string, u MultipartUpload) (int, int64, error) {
+	var (
+		parts int
+		size  int64
+	)
+	err := svc.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(u.Key),
+		UploadId: aws.String(u.UploadID),
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, p := range page.Parts {
+			parts++
+			size += aws.Int64Value(p.Size)
+		}
+		return true
+	})
+	if err != nil && !isAWSErrorCode(err, s3.ErrCodeNoSuchUpload) {
+		return 0, 0, wrapError(err)
+	}
+	return parts, size, nil
+}
+
+// StaleMultipartSweep returns a JanitorTask running AbortStaleMultipartUploads
+func StaleMultipartSweep(olderThan time.Duration) JanitorTask {
+	return func(ctx context.Context, sess *session.Session, bucket string) error {
+		_, err := AbortStaleMultipartUploads(ctx, sess, bucket, olderThan)
+		return err
+	}
+}
@@ -0,0 +1,65 @@
+package s3utils
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnicodeNormalization selects the Unicode normalization form used to match
+// local file names with keys during a sync. macOS file systems may return
+// names in NFD while most keys are written in NFC, so the same name would
+// otherwise be seen as two different entries and transferred on every run.
+type UnicodeNormalization int
+
+const (
+	// NormalizeNone compares names byte for byte
+	NormalizeNone UnicodeNormalization = iota
+	// NormalizeNFC compares names in composed form and writes new keys and
+	// files in it
+	NormalizeNFC
+	// NormalizeNFD compares names in decomposed form and writes new keys
+	// and files in it
+	NormalizeNFD
+)
+
+func (n UnicodeNormalization) String() string {
+	switch n {
+	case NormalizeNFC:
+		return "NFC"
+	case NormalizeNFD:
+		return "NFD"
+	}
+	return "none"
+}
+
+// apply returns name in the normalization form
+func (n UnicodeNormalization) apply(name string) string {
+	switch n {
+	case NormalizeNFC:
+		return norm.NFC.String(name)
+	case NormalizeNFD:
+		return norm.NFD.String(name)
+	}
+	return name
+}
+
+// normalizeNames rekeys entries by their normalized name. Two entries whose
+// names only differ in normalization are reported as an error, since a sync
+// could not tell which one the other side corresponds to.
+func normalizeNames[T any](entries map[string]T, n UnicodeNormalization) (map[string]T, error) {
+	if n == NormalizeNone {
+		return entries, nil
+	}
+	out := make(map[string]T, len(entries))
+	owners := make(map[string]string, len(entries))
+	for name, entry := range entries {
+		normalized := n.apply(name)
+		if other, ok := owners[normalized]; ok {
+			return nil, fmt.Errorf("s3utils: %q and %q are the same name in %s", other, name, n)
+		}
+		owners[normalized] = name
+		out[normalized] = entry
+	}
+	return out, nil
+}
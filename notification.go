@@ -0,0 +1,156 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// NotificationTarget is the kind of destination receiving bucket events
+type NotificationTarget string
+
+// Supported notification targets
+const (
+	NotifySQS    NotificationTarget = "sqs"
+	NotifySNS    NotificationTarget = "sns"
+	NotifyLambda NotificationTarget = "lambda"
+)
+
+// Common bucket event types
+const (
+	EventObjectCreated = s3.EventS3ObjectCreated
+	EventObjectRemoved = s3.EventS3ObjectRemoved
+)
+
+// NotificationRule sends the given events for keys matching Prefix and Suffix to ARN
+type NotificationRule struct {
+	ID     string             `json:"id,omitempty"`
+	Target NotificationTarget `json:"target"`
+	ARN    string             `json:"arn"`
+	Events []string           `json:"events"`
+	Prefix string             `json:"prefix,omitempty"`
+	Suffix string             `json:"suffix,omitempty"`
+}
+
+// GetBucketNotification returns the SQS, SNS and Lambda notification rules of bucket
+func GetBucketNotification(ctx context.Context, sess *session.Session, bucket string) ([]NotificationRule, error) {
+	out, err := getNotificationConfig(ctx, s3.New(sess), bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []NotificationRule
+	for _, c := range out.QueueConfigurations {
+		rules = append(rules, notificationRule(NotifySQS, c.Id, c.QueueArn, c.Events, c.Filter))
+	}
+	for _, c := range out.TopicConfigurations {
+		rules = append(rules, notificationRule(NotifySNS, c.Id, c.TopicArn, c.Events, c.Filter))
+	}
+	for _, c := range out.LambdaFunctionConfigurations {
+		rules = append(rules, notificationRule(NotifyLambda, c.Id, c.LambdaFunctionArn, c.Events, c.Filter))
+	}
+	return rules, nil
+}
+
+// PutBucketNotification replaces the SQS, SNS and Lambda notification rules
+// of bucket. The EventBridge setting is left unchanged. An empty rule set
+// removes all notifications.
+func PutBucketNotification(ctx context.Context, sess *session.Session, bucket string, rules []NotificationRule) error {
+	svc := s3.New(sess)
+	current, err := getNotificationConfig(ctx, svc, bucket)
+	if err != nil {
+		return err
+	}
+
+	cfg := &s3.NotificationConfiguration{EventBridgeConfiguration: current.EventBridgeConfiguration}
+	for _, r := range rules {
+		var id *string
+		if r.ID != "" {
+			id = aws.String(r.ID)
+		}
+		events := aws.StringSlice(r.Events)
+		filter := notificationFilter(r.Prefix, r.Suffix)
+		switch r.Target {
+		case NotifySQS:
+			cfg.QueueConfigurations = append(cfg.QueueConfigurations, &s3.QueueConfiguration{
+				Id: id, QueueArn: aws.String(r.ARN), Events: events, Filter: filter,
+			})
+		case NotifySNS:
+			cfg.TopicConfigurations = append(cfg.TopicConfigurations, &s3.TopicConfiguration{
+				Id: id, TopicArn: aws.String(r.ARN), Events: events, Filter: filter,
+			})
+		case NotifyLambda:
+			cfg.LambdaFunctionConfigurations = append(cfg.LambdaFunctionConfigurations, &s3.LambdaFunctionConfiguration{
+				Id: id, LambdaFunctionArn: aws.String(r.ARN), Events: events, Filter: filter,
+			})
+		default:
+			return fmt.Errorf("s3utils: unsupported notification target %q", r.Target)
+		}
+	}
+
+	_, err = svc.PutBucketNotificationConfigurationWithContext(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket:                    aws.String(bucket),
+		NotificationConfiguration: cfg,
+	})
+	return wrapError(err)
+}
+
+// AddBucketNotification adds rule to the notification rules of bucket,
+// replacing an existing rule with the same ID
+func AddBucketNotification(ctx context.Context, sess *session.Session, bucket string, rule NotificationRule) error {
+	rules, err := GetBucketNotification(ctx, sess, bucket)
+	if err != nil {
+		return err
+	}
+	merged := rules[:0]
+	for _, r := range rules {
+		if rule.ID == "" || r.ID != rule.ID {
+			merged = append(merged, r)
+		}
+	}
+	return PutBucketNotification(ctx, sess, bucket, append(merged, rule))
+}
+
+func getNotificationConfig(ctx context.Context, svc *s3.S3, bucket string) (*s3.NotificationConfiguration, error) {
+	out, err := svc.GetBucketNotificationConfigurationWithContext(ctx, &s3.GetBucketNotificationConfigurationRequest{
+		Bucket: aws.String(bucket),
+	})
+	return out, wrapError(err)
+}
+
+func notificationRule(target NotificationTarget, id, arn *string, events []*string, filter *s3.NotificationConfigurationFilter) NotificationRule {
+	r := NotificationRule{
+		ID:     aws.StringValue(id),
+		Target: target,
+		ARN:    aws.StringValue(arn),
+		Events: aws.StringValueSlice(events),
+	}
+	if filter != nil && filter.Key != nil {
+		for _, f := range filter.Key.FilterRules {
+			switch aws.StringValue(f.Name) {
+			case s3.FilterRuleNamePrefix:
+				r.Prefix = aws.StringValue(f.Value)
+			case s3.FilterRuleNameSuffix:
+				r.Suffix = aws.StringValue(f.Value)
+			}
+		}
+	}
+	return r
+}
+
+func notificationFilter(prefix, suffix string) *s3.NotificationConfigurationFilter {
+	var rules []*s3.FilterRule
+	if prefix != "" {
+		rules = append(rules, &s3.FilterRule{Name: aws.String(s3.FilterRuleNamePrefix), Value: aws.String(prefix)})
+	}
+	if suffix != "" {
+		rules = append(rules, &s3.FilterRule{Name: aws.String(s3.FilterRuleNameSuffix), Value: aws.String(suffix)})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &s3.NotificationConfigurationFilter{Key: &s3.KeyFilter{FilterRules: rules}}
+}
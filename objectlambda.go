@@ -0,0 +1,110 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// IsObjectLambdaARN reports whether bucket is an S3 Object Lambda access point ARN.
+// Such ARNs can be passed as the bucket of DownloadFile and the other GET helpers.
+func IsObjectLambdaARN(bucket string) bool {
+	a, err := arn.Parse(bucket)
+	return err == nil && a.Service == "s3-object-lambda" && strings.HasPrefix(a.Resource, "accesspoint")
+}
+
+// ObjectLambdaEvent is the part of the S3 Object Lambda invocation event
+// needed to answer a GetObject request
+type ObjectLambdaEvent struct {
+	XAmzRequestID    string `json:"xAmzRequestId"`
+	GetObjectContext struct {
+		InputS3URL  string `json:"inputS3Url"`
+		OutputRoute string `json:"outputRoute"`
+		OutputToken string `json:"outputToken"`
+	} `json:"getObjectContext"`
+	UserRequest struct {
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+	} `json:"userRequest"`
+	UserIdentity struct {
+		Type        string `json:"type"`
+		PrincipalID string `json:"principalId"`
+		ARN         string `json:"arn"`
+		AccountID   string `json:"accountId"`
+	} `json:"userIdentity"`
+}
+
+// FetchOriginalObject fetches the object the Object Lambda was invoked for
+// through the presigned URL in the event
+func FetchOriginalObject(ctx context.Context, event *ObjectLambdaEvent) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, event.GetObjectContext.InputS3URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3utils: fetching original object: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// WriteGetObjectResponse sends body as the response to the GetObject request
+// in event. The body is streamed without being buffered. Optional configure
+// functions can set the status, headers or error of the response.
+func WriteGetObjectResponse(ctx context.Context, sess *session.Session, event *ObjectLambdaEvent, body io.Reader, configure ...func(*s3.WriteGetObjectResponseInput)) error {
+	in := &s3.WriteGetObjectResponseInput{
+		RequestRoute: aws.String(event.GetObjectContext.OutputRoute),
+		RequestToken: aws.String(event.GetObjectContext.OutputToken),
+		Body:         aws.ReadSeekCloser(body),
+	}
+	for _, fn := range configure {
+		fn(in)
+	}
+	_, err := s3.New(sess).WriteGetObjectResponseWithContext(ctx, in)
+	return wrapError(err)
+}
+
+// TransformObjectLambda answers an Object Lambda GetObject request by
+// passing the original object through transform, for example to redact
+// fields. The original content type is kept. A failing transform is reported
+// to the caller as a 500 error response.
+func TransformObjectLambda(ctx context.Context, sess *session.Session, event *ObjectLambdaEvent, transform func(dst io.Writer, src io.Reader) error) error {
+	orig, err := FetchOriginalObject(ctx, event)
+	if err != nil {
+		return err
+	}
+	defer orig.Body.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(transform(pw, orig.Body))
+	}()
+	defer pr.Close()
+
+	err = WriteGetObjectResponse(ctx, sess, event, pr, func(in *s3.WriteGetObjectResponseInput) {
+		if ct := orig.Header.Get("Content-Type"); ct != "" {
+			in.ContentType = aws.String(ct)
+		}
+	})
+	if err == nil {
+		return nil
+	}
+	// Tell the waiting client why its request failed
+	WriteGetObjectResponse(ctx, sess, event, strings.NewReader(""), func(in *s3.WriteGetObjectResponseInput) {
+		in.StatusCode = aws.Int64(http.StatusInternalServerError)
+		in.ErrorCode = aws.String("TransformFailed")
+		in.ErrorMessage = aws.String(err.Error())
+	})
+	return err
+}
@@ -0,0 +1,188 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// objectReadAhead is the block size fetched per ranged GET
+const objectReadAhead = 8 << 20
+
+// objectReaderAt reads an object with ranged GETs, fetching objectReadAhead
+// bytes at a time so sequential reads need few requests. Reads are pinned to
+// etag so a concurrent overwrite fails instead of mixing versions.
+type objectReaderAt struct {
+	ctx    context.Context
+	svc    *s3.S3
+	bucket string
+	key    string
+	etag   string
+
+	mu       sync.Mutex
+	blockOff int64
+	block    []byte
+}
+
+func (o *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos < o.blockOff || pos >= o.blockOff+int64(len(o.block)) {
+			if err := o.fetch(pos); err != nil {
+				return n, err
+			}
+			if len(o.block) == 0 {
+				return n, io.EOF
+			}
+		}
+		n += copy(p[n:], o.block[pos-o.blockOff:])
+	}
+	return n, nil
+}
+
+// fetch loads the block starting at off
+func (o *objectReaderAt) fetch(off int64) error {
+	out, err := o.svc.GetObjectWithContext(o.ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(o.bucket),
+		Key:     aws.String(o.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-%d", off, off+objectReadAhead-1)),
+		IfMatch: aws.String(o.etag),
+	})
+	if err != nil {
+		if isAWSErrorCode(err, "InvalidRange") {
+			o.blockOff, o.block = off, nil
+			return nil
+		}
+		return wrapError(err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return wrapError(err)
+	}
+	o.blockOff, o.block = off, data
+	return nil
+}
+
+// ObjectReader gives random access to an S3 object through buffered ranged
+// GETs. It implements io.ReadSeekCloser and io.ReaderAt, so it can be passed
+// to zip, Parquet and media readers that need to seek. Every read is pinned
+// to the ETag seen when the object was opened; if the object is overwritten
+// later reads fail rather than returning a mix of versions.
+type ObjectReader struct {
+	ra     *objectReaderAt
+	size   int64
+	etag   string
+	off    int64
+	closed bool
+}
+
+// OpenObject opens bucket/key for random-access reads. ctx applies to every
+// request made by the returned reader.
+func OpenObject(ctx context.Context, sess *session.Session, bucket, key string) (*ObjectReader, error) {
+	svc := s3.New(sess)
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return newObjectReader(ctx, svc, bucket, key, head), nil
+}
+
+// newObjectReader reads the object described by head
+func newObjectReader(ctx context.Context, svc *s3.S3, bucket, key string, head *s3.HeadObjectOutput) *ObjectReader {
+	etag := aws.StringValue(head.ETag)
+	return &ObjectReader{
+		ra:   &objectReaderAt{ctx: ctx, svc: svc, bucket: bucket, key: key, etag: etag},
+		size: aws.Int64Value(head.ContentLength),
+		etag: etag,
+	}
+}
+
+// Size returns the object size in bytes
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// ETag returns the ETag of the object being read
+func (r *ObjectReader) ETag() string {
+	return r.etag
+}
+
+// ReadAt reads len(p) bytes starting at off. It is safe for concurrent use
+// but calls are serialized.
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("s3utils: negative read offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	short := false
+	if rest := r.size - off; int64(len(p)) > rest {
+		p, short = p[:rest], true
+	}
+	n, err := r.ra.ReadAt(p, off)
+	if err == nil && short {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Read reads from the current offset
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset for the next Read
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("s3utils: invalid seek whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("s3utils: negative seek offset")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// Close releases the read buffer. Reads after Close fail with fs.ErrClosed.
+func (r *ObjectReader) Close() error {
+	r.closed = true
+	r.ra.mu.Lock()
+	r.ra.block = nil
+	r.ra.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,132 @@
+package s3utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectInfo describes an object returned by a listing
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	StorageClass string
+	LastModified time.Time
+}
+
+func objectInfoFrom(obj *s3.Object) ObjectInfo {
+	return ObjectInfo{
+		Key:          aws.StringValue(obj.Key),
+		Size:         aws.Int64Value(obj.Size),
+		ETag:         aws.StringValue(obj.ETag),
+		StorageClass: aws.StringValue(obj.StorageClass),
+		LastModified: aws.TimeValue(obj.LastModified),
+	}
+}
+
+// WalkObjects calls fn for every object under prefix, stopping early if fn returns false
+func WalkObjects(ctx context.Context, sess *session.Session, bucket, prefix string, fn func(ObjectInfo) bool) error {
+	svc := s3.New(sess)
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if !fn(objectInfoFrom(obj)) {
+				return false
+			}
+		}
+		return true
+	})
+	return wrapError(err)
+}
+
+// ListObjects lists all objects under prefix
+func ListObjects(ctx context.Context, sess *session.Session, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		objects = append(objects, obj)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// DeleteObject deletes a single object
+func DeleteObject(ctx context.Context, sess *session.Session, bucket, key string) error {
+	svc := s3.New(sess)
+	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return wrapError(err)
+}
+
+// DeleteObjects deletes keys in batches of up to 1000 and returns the number deleted
+func DeleteObjects(ctx context.Context, sess *session.Session, bucket string, keys []string) (int, error) {
+	svc := s3.New(sess)
+	deleted := 0
+	for start := 0; start < len(keys); start += 1000 {
+		end := start + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		ids := make([]*s3.ObjectIdentifier, 0, end-start)
+		for _, k := range keys[start:end] {
+			ids = append(ids, &s3.ObjectIdentifier{Key: aws.String(k)})
+		}
+		out, err := svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, wrapError(err)
+		}
+		deleted += len(ids) - len(out.Errors)
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return deleted, wrapError(awsErrorf(aws.StringValue(e.Code), "delete %s: %s", aws.StringValue(e.Key), aws.StringValue(e.Message)))
+		}
+	}
+	return deleted, nil
+}
+
+// DeletePrefix deletes every object under prefix and returns the number deleted
+func DeletePrefix(ctx context.Context, sess *session.Session, bucket, prefix string) (int, error) {
+	var keys []string
+	err := WalkObjects(ctx, sess, bucket, prefix, func(obj ObjectInfo) bool {
+		keys = append(keys, obj.Key)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return DeleteObjects(ctx, sess, bucket, keys)
+}
+
+// PresignGetURL returns a pre-signed URL for downloading an object
+func PresignGetURL(sess *session.Session, bucket, key string, expires time.Duration) (string, error) {
+	svc := s3.New(sess)
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
+
+// PresignPutURL returns a pre-signed URL for uploading an object
+func PresignPutURL(sess *session.Session, bucket, key string, expires time.Duration) (string, error) {
+	svc := s3.New(sess)
+	req, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
@@ -0,0 +1,65 @@
+// Package otelhooks records OpenTelemetry spans for the S3 operations made
+// through an s3utils.Client:
+//
+//	client := s3utils.NewClient(sess, s3utils.WithInstrumentation(otelhooks.New(nil)))
+package otelhooks
+
+import (
+	"context"
+
+	"github.com/csmanutd/s3utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the tracer created by New
+const instrumentationName = "github.com/csmanutd/s3utils/otelhooks"
+
+// Tracing implements s3utils.Instrumentation by starting a client span per S3 operation
+type Tracing struct {
+	tracer trace.Tracer
+}
+
+// New creates a Tracing using tp, or the global tracer provider if tp is nil
+func New(tp trace.TracerProvider) *Tracing {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracing{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Start starts a span named S3.<operation>
+func (t *Tracing) Start(ctx context.Context, operation string) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "S3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", "S3"),
+			attribute.String("rpc.method", operation),
+		),
+	)
+	return ctx
+}
+
+// End records the operation metrics on the span and ends it
+func (t *Tracing) End(ctx context.Context, m s3utils.OperationMetrics) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("aws.s3.bucket", m.Bucket),
+		attribute.Int64("s3utils.bytes", m.Bytes),
+		attribute.Int("s3utils.retries", m.Retries),
+	)
+	if m.Key != "" {
+		span.SetAttributes(attribute.String("aws.s3.key", m.Key))
+	}
+	if m.StatusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", m.StatusCode))
+	}
+	if m.Err != nil {
+		span.RecordError(m.Err)
+		span.SetStatus(codes.Error, m.Err.Error())
+	}
+	span.End()
+}
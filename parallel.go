@@ -0,0 +1,56 @@
+package s3utils
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultConcurrency is the number of workers used by bulk operations when none is configured
+const DefaultConcurrency = 4
+
+// runParallel calls fn for every item using up to n workers. The first
+// error cancels the remaining work and is returned.
+func runParallel[T any](ctx context.Context, n int, items []T, fn func(context.Context, T) error) error {
+	if n <= 0 {
+		n = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	work := make(chan T)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if err := fn(ctx, item); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case work <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,295 @@
+package s3utils
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+)
+
+// parquetRowGroupRows is the number of listed objects buffered per row group
+const parquetRowGroupRows = 50000
+
+const parquetMagic = "PAR1"
+
+// Parquet physical and converted types, page types, encodings and codecs
+// from the Parquet format specification
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetRequired = 0
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetDataPage = 0
+	parquetPlain    = 0
+	parquetRLE      = 3
+	parquetSnappy   = 1
+)
+
+// parquetColumn is one column of the listing schema
+type parquetColumn struct {
+	name string
+	typ  int32
+	// converted is the converted type, or -1 for none
+	converted int32
+	encode    func(buf []byte, obj ObjectInfo) []byte
+}
+
+// parquetColumns is the listing schema, matching the CSV and JSON manifests.
+// Every column is required; last_modified is a UTC timestamp in milliseconds.
+var parquetColumns = []parquetColumn{
+	{"key", parquetByteArray, parquetUTF8, func(buf []byte, obj ObjectInfo) []byte {
+		return appendParquetString(buf, obj.Key)
+	}},
+	{"size", parquetInt64, -1, func(buf []byte, obj ObjectInfo) []byte {
+		return binary.LittleEndian.AppendUint64(buf, uint64(obj.Size))
+	}},
+	{"etag", parquetByteArray, parquetUTF8, func(buf []byte, obj ObjectInfo) []byte {
+		return appendParquetString(buf, strings.Trim(obj.ETag, `"`))
+	}},
+	{"storage_class", parquetByteArray, parquetUTF8, func(buf []byte, obj ObjectInfo) []byte {
+		return appendParquetString(buf, obj.StorageClass)
+	}},
+	{"last_modified", parquetInt64, parquetTimestampMillis, func(buf []byte, obj ObjectInfo) []byte {
+		return binary.LittleEndian.AppendUint64(buf, uint64(obj.LastModified.UnixMilli()))
+	}},
+}
+
+func appendParquetString(buf []byte, s string) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+// parquetChunk records where a column chunk was written
+type parquetChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// parquetManifest writes the listing as a Snappy-compressed Parquet file.
+// Objects are buffered one row group at a time, so memory use is bounded
+// by parquetRowGroupRows regardless of the prefix size.
+type parquetManifest struct {
+	w      io.Writer
+	offset int64
+	rows   []ObjectInfo
+	groups []parquetRowGroup
+}
+
+func newParquetManifest(w io.Writer) (*parquetManifest, error) {
+	m := &parquetManifest{w: w}
+	return m, m.writeRaw([]byte(parquetMagic))
+}
+
+func (m *parquetManifest) writeRaw(b []byte) error {
+	n, err := m.w.Write(b)
+	m.offset += int64(n)
+	return err
+}
+
+func (m *parquetManifest) write(obj ObjectInfo) error {
+	m.rows = append(m.rows, obj)
+	if len(m.rows) < parquetRowGroupRows {
+		return nil
+	}
+	return m.flush()
+}
+
+// flush writes the buffered rows as a row group with one data page per column
+func (m *parquetManifest) flush() error {
+	if len(m.rows) == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(len(m.rows))}
+	var values []byte
+	for _, col := range parquetColumns {
+		values = values[:0]
+		for _, obj := range m.rows {
+			values = col.encode(values, obj)
+		}
+		compressed := snappy.Encode(nil, values)
+
+		var t thriftCompact
+		t.begin()
+		t.i32(1, parquetDataPage)
+		t.i32(2, int32(len(values)))
+		t.i32(3, int32(len(compressed)))
+		t.structField(5)
+		t.i32(1, int32(len(m.rows)))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.end()
+		t.end()
+
+		chunk := parquetChunk{
+			offset:       m.offset,
+			uncompressed: int64(len(t.buf) + len(values)),
+			compressed:   int64(len(t.buf) + len(compressed)),
+		}
+		if err := m.writeRaw(t.buf); err != nil {
+			return err
+		}
+		if err := m.writeRaw(compressed); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+	}
+	m.groups = append(m.groups, group)
+	m.rows = m.rows[:0]
+	return nil
+}
+
+// close flushes the last row group and writes the file footer
+func (m *parquetManifest) close() error {
+	if err := m.flush(); err != nil {
+		return err
+	}
+	var total int64
+	for _, g := range m.groups {
+		total += g.rows
+	}
+
+	var t thriftCompact
+	t.begin()
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(parquetColumns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(parquetColumns)))
+	t.end()
+	for _, col := range parquetColumns {
+		t.begin()
+		t.i32(1, col.typ)
+		t.i32(3, parquetRequired)
+		t.binary(4, col.name)
+		if col.converted >= 0 {
+			t.i32(6, col.converted)
+		}
+		t.end()
+	}
+	t.i64(3, total)
+	t.list(4, thriftStruct, len(m.groups))
+	for _, g := range m.groups {
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		var size int64
+		for i, c := range g.chunks {
+			size += c.uncompressed
+			t.begin()
+			t.i64(2, c.offset)
+			t.structField(3)
+			t.i32(1, parquetColumns[i].typ)
+			t.list(2, thriftI32, 1)
+			t.varint(parquetPlain)
+			t.list(3, thriftBinary, 1)
+			t.str(parquetColumns[i].name)
+			t.i32(4, parquetSnappy)
+			t.i64(5, g.rows)
+			t.i64(6, c.uncompressed)
+			t.i64(7, c.compressed)
+			t.i64(9, c.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.binary(6, "s3utils")
+	t.end()
+
+	footer := binary.LittleEndian.AppendUint32(t.buf, uint32(len(t.buf)))
+	return m.writeRaw(append(footer, parquetMagic...))
+}
+
+// Thrift compact protocol type identifiers
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact encodes the Thrift compact protocol structures of Parquet
+// page headers and file metadata. Structs are opened with begin, or
+// structField for a nested field, and closed with end.
+type thriftCompact struct {
+	buf []byte
+	// last holds the last field id written in each open struct
+	last []int16
+}
+
+func (t *thriftCompact) begin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftCompact) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	top := len(t.last) - 1
+	if delta := id - t.last[top]; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.varint(int64(id))
+	}
+	t.last[top] = id
+}
+
+// varint writes a zigzag-encoded integer, as used for i16, i32 and i64
+func (t *thriftCompact) varint(v int64) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(v<<1^v>>63))
+}
+
+// str writes a binary value without a field header, as in lists
+func (t *thriftCompact) str(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftCompact) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.str(s)
+}
+
+func (t *thriftCompact) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list writes the header of a list of n elements of type elem; the caller
+// writes the elements
+func (t *thriftCompact) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+		return
+	}
+	t.buf = append(t.buf, 0xf0|elem)
+	t.buf = binary.AppendUvarint(t.buf, uint64(n))
+}
@@ -0,0 +1,55 @@
+package s3utils
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// PrefixExists checks if at least one object exists under prefix
+func PrefixExists(ctx context.Context, sess *session.Session, bucket, prefix string) (bool, error) {
+	svc := s3.New(sess)
+	out, err := svc.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(1),
+	})
+	if err != nil {
+		return false, wrapError(err)
+	}
+	return aws.Int64Value(out.KeyCount) > 0, nil
+}
+
+// CountObjects returns the number of objects under prefix
+func CountObjects(ctx context.Context, sess *session.Session, bucket, prefix string) (int64, error) {
+	count, _, err := prefixStats(ctx, sess, bucket, prefix)
+	return count, err
+}
+
+// TotalSize returns the combined size in bytes of all objects under prefix
+func TotalSize(ctx context.Context, sess *session.Session, bucket, prefix string) (int64, error) {
+	_, size, err := prefixStats(ctx, sess, bucket, prefix)
+	return size, err
+}
+
+// prefixStats pages through prefix and returns the object count and total size
+func prefixStats(ctx context.Context, sess *session.Session, bucket, prefix string) (int64, int64, error) {
+	svc := s3.New(sess)
+	var count, size int64
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			count++
+			size += aws.Int64Value(obj.Size)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, 0, wrapError(err)
+	}
+	return count, size, nil
+}
@@ -0,0 +1,199 @@
+package s3utils
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ProgressEventType identifies the kind of a ProgressEvent
+type ProgressEventType string
+
+// Progress event types emitted during transfers
+const (
+	ProgressStarted       ProgressEventType = "started"
+	ProgressPartCompleted ProgressEventType = "part-completed"
+	ProgressRetried       ProgressEventType = "retried"
+	ProgressFinished      ProgressEventType = "finished"
+	ProgressFailed        ProgressEventType = "failed"
+)
+
+// ProgressEvent is a machine-readable transfer progress notification
+type ProgressEvent struct {
+	Type   ProgressEventType `json:"type"`
+	Time   time.Time         `json:"time"`
+	Bucket string            `json:"bucket"`
+	Key    string            `json:"key"`
+	// Part is the 1-based part number for part and retry events
+	Part int64 `json:"part,omitempty"`
+	// Bytes is the size of the completed part
+	Bytes int64 `json:"bytes,omitempty"`
+	// Total is the full transfer size when known
+	Total int64 `json:"total,omitempty"`
+	// Attempt is the retry attempt number for retry events
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ProgressSink receives progress events. It may be called from multiple goroutines.
+type ProgressSink func(ProgressEvent)
+
+// JSONLinesProgress returns a sink that writes each event to w as one JSON object per line
+func JSONLinesProgress(w io.Writer) ProgressSink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
+
+// ChannelProgress returns a sink that sends each event to ch
+func ChannelProgress(ch chan<- ProgressEvent) ProgressSink {
+	return func(e ProgressEvent) {
+		ch <- e
+	}
+}
+
+func (s ProgressSink) emit(e ProgressEvent) {
+	if s == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s(e)
+}
+
+// finish emits the finished or failed event for a transfer
+func (s ProgressSink) finish(bucket, key string, err error) {
+	e := ProgressEvent{Type: ProgressFinished, Bucket: bucket, Key: key}
+	if err != nil {
+		e.Type = ProgressFailed
+		e.Error = err.Error()
+	}
+	s.emit(e)
+}
+
+// requestOption returns a request option reporting completed parts and retries to the sink
+func (s ProgressSink) requestOption() request.Option {
+	return func(r *request.Request) {
+		r.Handlers.Complete.PushBack(func(r *request.Request) {
+			if r.Error != nil {
+				return
+			}
+			bucket, key, part := requestTarget(r)
+			if part == 0 {
+				// Not a transfer request, e.g. CreateMultipartUpload
+				return
+			}
+			s.emit(ProgressEvent{
+				Type:   ProgressPartCompleted,
+				Bucket: bucket,
+				Key:    key,
+				Part:   part,
+				Bytes:  transferredBytes(r),
+			})
+		})
+		r.Handlers.AfterRetry.PushFront(func(r *request.Request) {
+			if !r.WillRetry() {
+				return
+			}
+			bucket, key, part := requestTarget(r)
+			s.emit(ProgressEvent{
+				Type:    ProgressRetried,
+				Bucket:  bucket,
+				Key:     key,
+				Part:    part,
+				Attempt: r.RetryCount + 1,
+				Error:   r.Error.Error(),
+			})
+		})
+	}
+}
+
+// requestTarget extracts the bucket, key and part number a transfer request
+// acts on. The part number is zero for requests that transfer no object data.
+func requestTarget(r *request.Request) (string, string, int64) {
+	switch in := r.Params.(type) {
+	case *s3.PutObjectInput:
+		return aws.StringValue(in.Bucket), aws.StringValue(in.Key), 1
+	case *s3.UploadPartInput:
+		return aws.StringValue(in.Bucket), aws.StringValue(in.Key), aws.Int64Value(in.PartNumber)
+	case *s3.GetObjectInput:
+		part := aws.Int64Value(in.PartNumber)
+		if part == 0 {
+			part = rangePart(aws.StringValue(in.Range))
+		}
+		return aws.StringValue(in.Bucket), aws.StringValue(in.Key), part
+	}
+	return "", "", 0
+}
+
+// rangePart returns the part number of a ranged GET made by the transfer
+// manager, which splits downloads into parts of DefaultDownloadPartSize, and
+// 1 for a GET of the whole object
+func rangePart(rng string) int64 {
+	if rng == "" {
+		return 1
+	}
+	start, _, ok := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+	if !ok {
+		return 1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || n < 0 {
+		return 1
+	}
+	return n/s3manager.DefaultDownloadPartSize + 1
+}
+
+// transferredBytes returns the payload size of a completed transfer request
+func transferredBytes(r *request.Request) int64 {
+	if out, ok := r.Data.(*s3.GetObjectOutput); ok {
+		return aws.Int64Value(out.ContentLength)
+	}
+	if r.HTTPRequest != nil {
+		return r.HTTPRequest.ContentLength
+	}
+	return 0
+}
+
+// readerSize returns the size of r when it can be determined without reading it
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case *os.File:
+		if info, err := v.Stat(); err == nil {
+			return info.Size()
+		}
+	case interface{ Len() int }:
+		return int64(v.Len())
+	}
+	return 0
+}
+
+// WithProgress reports upload progress events to sink
+func WithProgress(sink ProgressSink) UploadOption {
+	return func(c *uploadConfig) {
+		c.progress = sink
+		c.requestOptions = append(c.requestOptions, sink.requestOption())
+	}
+}
+
+// WithDownloadProgress reports download progress events to sink
+func WithDownloadProgress(sink ProgressSink) DownloadOption {
+	return func(c *downloadConfig) {
+		c.progress = sink
+		c.requestOptions = append(c.requestOptions, sink.requestOption())
+	}
+}
@@ -0,0 +1,206 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// ReceiptPrefix is the prefix receipt objects are written under
+const ReceiptPrefix = "receipts"
+
+// ErrInvalidReceipt is returned by VerifyReceipt when a receipt does not
+// match its signature or the object it describes
+var ErrInvalidReceipt = errors.New("s3utils: invalid upload receipt")
+
+// Receipt is a signed record of a completed upload
+type Receipt struct {
+	Bucket     string    `json:"bucket"`
+	Key        string    `json:"key"`
+	VersionID  string    `json:"version_id,omitempty"`
+	ETag       string    `json:"etag"`
+	SHA256     string    `json:"sha256"`
+	Uploader   string    `json:"uploader"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Signature  []byte    `json:"signature,omitempty"`
+}
+
+// signedBytes returns the canonical encoding covered by the signature
+func (r Receipt) signedBytes() ([]byte, error) {
+	r.Signature = nil
+	return json.Marshal(r)
+}
+
+// ReceiptSigner signs upload receipts with an Ed25519 key
+type ReceiptSigner struct {
+	key ed25519.PrivateKey
+	sts *sts.STS
+
+	// Identity names the uploader in receipts. If empty, the caller ARN
+	// reported by STS is used. It must not be changed once the signer is in use.
+	Identity string
+
+	mu     sync.Mutex
+	caller string
+}
+
+// NewReceiptSigner creates a ReceiptSigner. Auditors verify its receipts with key.Public().
+func NewReceiptSigner(sess *session.Session, key ed25519.PrivateKey) *ReceiptSigner {
+	return &ReceiptSigner{key: key, sts: sts.New(sess)}
+}
+
+// WithReceipt writes a signed receipt for the upload under ReceiptPrefix in
+// the same bucket. The body must be seekable so its SHA-256 can be computed
+// before it is sent.
+func WithReceipt(s *ReceiptSigner) UploadOption {
+	return func(c *uploadConfig) {
+		c.receipt = s
+	}
+}
+
+// identity returns the uploader identity recorded in receipts
+func (s *ReceiptSigner) identity(ctx context.Context) (string, error) {
+	if s.Identity != "" {
+		return s.Identity, nil
+	}
+	// Concurrent uploads share one lookup; a failed one is retried by the next upload
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.caller != "" {
+		return s.caller, nil
+	}
+	out, err := s.sts.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", wrapError(err)
+	}
+	s.caller = aws.StringValue(out.Arn)
+	return s.caller, nil
+}
+
+// bodySHA256 hashes a seekable upload body and rewinds it
+func bodySHA256(body io.Reader) (string, error) {
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return "", errors.New("s3utils: upload receipts require a seekable body")
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, seeker); err != nil {
+		return "", err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileSHA256Hex returns the hex SHA-256 digest of a file as recorded in receipts
+func fileSHA256Hex(fileName string) (string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return bodySHA256(file)
+}
+
+// write signs and stores the receipt for result and returns its key
+func (s *ReceiptSigner) write(ctx context.Context, sess *session.Session, result *UploadResult, sum string) (string, error) {
+	uploader, err := s.identity(ctx)
+	if err != nil {
+		return "", err
+	}
+	receipt := Receipt{
+		Bucket:     result.Bucket,
+		Key:        result.Key,
+		VersionID:  result.VersionID,
+		ETag:       result.ETag,
+		SHA256:     sum,
+		Uploader:   uploader,
+		UploadedAt: time.Now().UTC(),
+	}
+	msg, err := receipt.signedBytes()
+	if err != nil {
+		return "", err
+	}
+	receipt.Signature = ed25519.Sign(s.key, msg)
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return "", err
+	}
+
+	key := JoinKey(ReceiptPrefix, result.Key, strconv.FormatInt(receipt.UploadedAt.UnixNano(), 10)+".json")
+	svc := s3.New(sess)
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(result.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}), internalWrite)
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return key, nil
+}
+
+// VerifyReceipt reads the receipt at bucket/receiptKey, checks its signature
+// against pub and checks that the object it describes is still the one that
+// was delivered. It returns ErrInvalidReceipt if either check fails.
+func VerifyReceipt(ctx context.Context, sess *session.Session, bucket, receiptKey string, pub ed25519.PublicKey) (*Receipt, error) {
+	svc := s3.New(sess)
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(receiptKey),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	defer out.Body.Close()
+
+	var receipt Receipt
+	if err := json.NewDecoder(out.Body).Decode(&receipt); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+	msg, err := receipt.signedBytes()
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pub, msg, receipt.Signature) {
+		return &receipt, fmt.Errorf("%w: signature does not match", ErrInvalidReceipt)
+	}
+
+	head := &s3.HeadObjectInput{
+		Bucket: aws.String(receipt.Bucket),
+		Key:    aws.String(receipt.Key),
+	}
+	if receipt.VersionID != "" {
+		head.VersionId = aws.String(receipt.VersionID)
+	}
+	obj, err := svc.HeadObjectWithContext(ctx, head)
+	if err != nil {
+		return &receipt, wrapError(err)
+	}
+	if aws.StringValue(obj.ETag) != receipt.ETag {
+		return &receipt, fmt.Errorf("%w: object %s has changed since delivery", ErrInvalidReceipt, receipt.Key)
+	}
+	return &receipt, nil
+}
@@ -0,0 +1,209 @@
+package s3utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ReplicateOptions configures ReplicatePrefix
+type ReplicateOptions struct {
+	// DstPrefix replaces prefix in the destination keys. Empty keeps the source keys.
+	DstPrefix string
+	// ManifestFile records every replicated key and ETag, one JSON object
+	// per line, so an interrupted run skips finished objects when resumed.
+	// Empty disables resuming.
+	ManifestFile string
+	// Concurrency is the number of parallel copies. Zero uses DefaultConcurrency.
+	Concurrency int
+	// OnProgress is called after every object is processed
+	OnProgress func(ReplicateReport)
+}
+
+// ReplicateReport counts the objects handled by ReplicatePrefix
+type ReplicateReport struct {
+	Scanned int
+	// Copied objects were replicated with a server-side copy
+	Copied int
+	// Streamed objects were downloaded with the source session and uploaded
+	// with the destination session
+	Streamed int
+	// Skipped objects were already recorded in the manifest
+	Skipped int
+}
+
+// replicaRecord is one line of a replication manifest
+type replicaRecord struct {
+	Key  string `json:"key"`
+	ETag string `json:"etag"`
+}
+
+// ReplicatePrefix copies every object under prefix from srcBucket to
+// dstBucket, which may be in another region or account. Objects are copied
+// server-side with the destination session when it can read the source;
+// otherwise they are streamed from srcSess to dstSess.
+func ReplicatePrefix(ctx context.Context, srcSess, dstSess *session.Session, srcBucket, dstBucket, prefix string, opts ReplicateOptions) (*ReplicateReport, error) {
+	done, err := loadReplicaManifest(opts.ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	var manifest *os.File
+	if opts.ManifestFile != "" {
+		manifest, err = os.OpenFile(opts.ManifestFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		defer manifest.Close()
+	}
+
+	r := &replicator{
+		srcSess:   srcSess,
+		dstSess:   dstSess,
+		srcBucket: srcBucket,
+		dstBucket: dstBucket,
+		dstSvc:    s3.New(dstSess),
+		manifest:  manifest,
+		report:    &ReplicateReport{},
+		opts:      opts,
+	}
+	objects, err := ListObjects(ctx, srcSess, srcBucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	r.report.Scanned = len(objects)
+
+	err = runParallel(ctx, opts.Concurrency, objects, func(ctx context.Context, obj ObjectInfo) error {
+		if done[obj.Key] == obj.ETag {
+			r.record(obj, func(rep *ReplicateReport) { rep.Skipped++ }, false)
+			return nil
+		}
+		dstKey := obj.Key
+		if opts.DstPrefix != "" {
+			dstKey = opts.DstPrefix + strings.TrimPrefix(obj.Key, prefix)
+		}
+		streamed, err := r.replicate(ctx, obj.Key, dstKey)
+		if err != nil {
+			return fmt.Errorf("s3utils: replicate %s: %w", obj.Key, err)
+		}
+		return r.record(obj, func(rep *ReplicateReport) {
+			if streamed {
+				rep.Streamed++
+			} else {
+				rep.Copied++
+			}
+		}, true)
+	})
+	return r.report, err
+}
+
+// replicator holds the state shared by the ReplicatePrefix workers
+type replicator struct {
+	srcSess, dstSess     *session.Session
+	srcBucket, dstBucket string
+	dstSvc               *s3.S3
+	opts                 ReplicateOptions
+
+	// noServerCopy is set once a server-side copy is denied
+	noServerCopy atomic.Bool
+
+	mu       sync.Mutex
+	manifest *os.File
+	report   *ReplicateReport
+}
+
+// replicate copies one object and reports whether it had to be streamed
+func (r *replicator) replicate(ctx context.Context, srcKey, dstKey string) (bool, error) {
+	if !r.noServerCopy.Load() {
+		err := copyObject(ctx, r.dstSvc, r.srcBucket, srcKey, &s3.CopyObjectInput{
+			Bucket: aws.String(r.dstBucket),
+			Key:    aws.String(dstKey),
+		})
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, ErrAccessDenied) && !errors.Is(err, ErrObjectNotFound) && !errors.Is(err, ErrBucketNotFound) {
+			return false, err
+		}
+		// The destination credentials cannot read the source
+		r.noServerCopy.Store(true)
+	}
+
+	out, err := s3.New(r.srcSess).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.srcBucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return true, wrapError(err)
+	}
+	defer out.Body.Close()
+
+	_, err = s3manager.NewUploader(r.dstSess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:             aws.String(r.dstBucket),
+		Key:                aws.String(dstKey),
+		Body:               out.Body,
+		ContentType:        out.ContentType,
+		ContentEncoding:    out.ContentEncoding,
+		ContentDisposition: out.ContentDisposition,
+		CacheControl:       out.CacheControl,
+		Metadata:           out.Metadata,
+	})
+	return true, wrapError(err)
+}
+
+// record updates the report and, for newly replicated objects, the manifest
+func (r *replicator) record(obj ObjectInfo, update func(*ReplicateReport), write bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	update(r.report)
+	if write && r.manifest != nil {
+		line, err := json.Marshal(replicaRecord{Key: obj.Key, ETag: obj.ETag})
+		if err != nil {
+			return err
+		}
+		if _, err := r.manifest.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	if r.opts.OnProgress != nil {
+		r.opts.OnProgress(*r.report)
+	}
+	return nil
+}
+
+// loadReplicaManifest reads the key to ETag map of a replication manifest
+func loadReplicaManifest(fileName string) (map[string]string, error) {
+	done := make(map[string]string)
+	if fileName == "" {
+		return done, nil
+	}
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec replicaRecord
+		// A line cut short by an interrupted run is ignored
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil {
+			done[rec.Key] = rec.ETag
+		}
+	}
+	return done, scanner.Err()
+}
@@ -0,0 +1,145 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// CollisionBackoff returns how long to wait before trying the next candidate
+// after the given number of collisions, starting at 1
+type CollisionBackoff func(collisions int) time.Duration
+
+// JitteredBackoff waits a random duration up to base doubled after each
+// collision, capped at max
+func JitteredBackoff(base, max time.Duration) CollisionBackoff {
+	return func(collisions int) time.Duration {
+		limit := max
+		if collisions < 30 && base<<collisions < max {
+			limit = base << collisions
+		}
+		if limit <= 0 {
+			return 0
+		}
+		return rand.N(limit)
+	}
+}
+
+// CollisionMetrics counts the claims made by ReserveUniqueKeyWithOptions.
+// A single value may be shared by many concurrent writers.
+type CollisionMetrics struct {
+	attempts   atomic.Int64
+	collisions atomic.Int64
+}
+
+// Attempts returns the number of candidate keys tried
+func (m *CollisionMetrics) Attempts() int64 {
+	return m.attempts.Load()
+}
+
+// Collisions returns the number of candidates that were already taken
+func (m *CollisionMetrics) Collisions() int64 {
+	return m.collisions.Load()
+}
+
+// Rate returns the fraction of attempts that collided
+func (m *CollisionMetrics) Rate() float64 {
+	attempts := m.attempts.Load()
+	if attempts == 0 {
+		return 0
+	}
+	return float64(m.collisions.Load()) / float64(attempts)
+}
+
+// ReserveOptions tunes ReserveUniqueKeyWithOptions for many concurrent writers
+type ReserveOptions struct {
+	// Backoff delays the next attempt after a collision. Nil uses
+	// JitteredBackoff(10ms, time.Second).
+	Backoff CollisionBackoff
+	// MaxAttempts bounds the number of candidates tried. Zero allows 100.
+	MaxAttempts int
+	// Metrics, when set, records attempts and collisions
+	Metrics *CollisionMetrics
+	// Format builds the alternatives to the base name. Nil uses CounterFormat.
+	Format NameFormat
+}
+
+// ReserveUniqueKey claims a free key in folder for baseName and returns it.
+// Candidates follow the naming of GenerateUniqueFileName, but each one is
+// claimed by writing a zero-byte placeholder with If-None-Match: *, so two
+// writers racing on the same name never receive the same key. The caller is
+// expected to upload its content over the returned key.
+func ReserveUniqueKey(ctx context.Context, sess *session.Session, bucket, folder, baseName string) (string, error) {
+	return ReserveUniqueKeyWithOptions(ctx, sess, bucket, folder, baseName, ReserveOptions{})
+}
+
+// ReserveUniqueKeyWithOptions claims a key like ReserveUniqueKey. After each
+// collision it waits for the backoff and skips ahead by a random number of
+// candidates that grows with the collision count, so writers racing on the
+// same name spread out instead of contending for every suffix in turn.
+func ReserveUniqueKeyWithOptions(ctx context.Context, sess *session.Session, bucket, folder, baseName string, opts ReserveOptions) (string, error) {
+	backoff := opts.Backoff
+	if backoff == nil {
+		backoff = JitteredBackoff(10*time.Millisecond, time.Second)
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = maxCounterAttempts
+	}
+
+	names := UniqueNameOptions{Format: opts.Format}
+	svc := s3.New(sess)
+	candidate := 0
+	for collisions := 0; ; {
+		key := JoinKey(folder, names.candidate(baseName, candidate))
+		if opts.Metrics != nil {
+			opts.Metrics.attempts.Add(1)
+		}
+		_, err := svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(nil),
+		}, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}), internalWrite)
+		if err == nil {
+			return key, nil
+		}
+		if !isConditionalConflict(err) {
+			return "", wrapError(err)
+		}
+
+		// Taken by an existing object or a concurrent writer
+		collisions++
+		if opts.Metrics != nil {
+			opts.Metrics.collisions.Add(1)
+		}
+		if collisions >= maxAttempts {
+			return "", &NamesExhaustedError{Folder: folder, BaseName: baseName, Attempts: maxAttempts}
+		}
+		candidate += 1 + rand.IntN(collisions)
+		if err := sleepCtx(ctx, backoff(collisions)); err != nil {
+			return "", err
+		}
+	}
+}
+
+// sleepCtx waits for d or until ctx is done
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -1,12 +1,14 @@
 package s3utils
 
 import (
-	"fmt"
+	"context"
+	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -14,48 +16,29 @@ import (
 
 // CheckS3FileExists checks if a file exists in the S3 bucket
 func CheckS3FileExists(sess *session.Session, bucket, key string) (bool, error) {
-	svc := s3.New(sess)
-	_, err := svc.HeadObject(&s3.HeadObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
+	return CheckS3FileVersionExists(sess, bucket, key, "")
 }
 
-// GenerateUniqueFileName generates a unique file name for S3
+// GenerateUniqueFileName generates a unique file name for S3. The name is
+// only probed, not claimed; concurrent writers should use ReserveUniqueKey.
 func GenerateUniqueFileName(sess *session.Session, bucket, folder, baseName string) (string, error) {
-	// Get file extension
-	ext := filepath.Ext(baseName)
-	nameWithoutExt := baseName[:len(baseName)-len(ext)]
-
-	// First, try the original filename
-	key := filepath.Join(folder, baseName)
-	exists, err := CheckS3FileExists(sess, bucket, key)
-	if err != nil {
-		return "", err
-	}
-	if !exists {
-		return baseName, nil
-	}
+	return GenerateUniqueFileNameWithOptions(sess, bucket, folder, baseName, UniqueNameOptions{})
+}
 
-	// If the original filename exists, start appending numbers
-	for i := 1; ; i++ {
-		fileName := fmt.Sprintf("%s_%d%s", nameWithoutExt, i, ext)
-		key = filepath.Join(folder, fileName)
-		exists, err := CheckS3FileExists(sess, bucket, key)
+// generateUniqueFileName finds a free file name in folder using exists to probe keys
+func generateUniqueFileName(folder, baseName string, opts UniqueNameOptions, exists func(key string) (bool, error)) (string, error) {
+	// Try the original filename first, then the alternatives of opts.Format
+	for i := 0; opts.MaxAttempts <= 0 || i < opts.MaxAttempts; i++ {
+		fileName := opts.candidate(baseName, i)
+		found, err := exists(JoinKey(folder, fileName))
 		if err != nil {
 			return "", err
 		}
-		if !exists {
+		if !found {
 			return fileName, nil
 		}
 	}
+	return "", &NamesExhaustedError{Folder: folder, BaseName: baseName, Attempts: opts.MaxAttempts}
 }
 
 // UploadToS3 uploads a file to S3
@@ -65,32 +48,299 @@ func UploadToS3(region, profile, fileName, bucket, folder string) error {
 		return err
 	}
 
+	_, err = UploadFile(context.Background(), sess, fileName, bucket, folder)
+	return err
+}
+
+// uploadConfig holds the state that UploadOptions act on
+type uploadConfig struct {
+	input          *s3manager.UploadInput
+	requestOptions []request.Option
+	progress       ProgressSink
+	fallback       []string
+	encrypt        *EnvelopeEncryption
+	receipt        *ReceiptSigner
+	// sent, when set, digests the body as it is sent, after encryption
+	sent *partHasher
+	// detectedContentType is the Content-Type set by detection, so options
+	// can tell it from one set explicitly
+	detectedContentType *string
+}
+
+// UploadOption customizes an upload performed by UploadFile
+type UploadOption func(*uploadConfig)
+
+// WithUploadInput applies fn to the upload input before it is sent
+func WithUploadInput(fn func(*s3manager.UploadInput)) UploadOption {
+	return func(c *uploadConfig) {
+		fn(c.input)
+	}
+}
+
+// UploadResult describes a completed upload
+type UploadResult struct {
+	Bucket    string
+	Key       string
+	Location  string
+	VersionID string
+	ETag      string
+	// StorageClass is the class the object was stored in, empty for the bucket default
+	StorageClass string
+	// RequestedStorageClass is the class originally asked for when the
+	// upload fell back to another class, empty otherwise
+	RequestedStorageClass string
+	// ReceiptKey is the key of the signed receipt written by WithReceipt
+	ReceiptKey string
+}
+
+// Downgraded reports whether the object was stored in a fallback storage class
+func (r *UploadResult) Downgraded() bool {
+	return r.RequestedStorageClass != ""
+}
+
+// newUploadConfig builds the upload configuration for body stored at bucket/key.
+// The Content-Type is detected from the key and body unless an option sets it.
+func newUploadConfig(bucket, key string, body io.Reader, opts []UploadOption) *uploadConfig {
+	cfg := &uploadConfig{
+		input: &s3manager.UploadInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   body,
+		},
+	}
+	// Detected before the options run so they can see and override it
+	if ct := detectBodyContentType(key, body); ct != "" {
+		cfg.input.ContentType = aws.String(ct)
+		cfg.detectedContentType = cfg.input.ContentType
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// upload sends the configured upload through the transfer manager
+func (c *uploadConfig) upload(ctx context.Context, sess *session.Session) (*UploadResult, error) {
+	bucket, key := aws.StringValue(c.input.Bucket), aws.StringValue(c.input.Key)
+	// Sized before encryption replaces the body with a pipe
+	total := readerSize(c.input.Body)
+	var sum string
+	if c.receipt != nil {
+		var err error
+		if sum, err = bodySHA256(c.input.Body); err != nil {
+			return nil, err
+		}
+	}
+	if c.encrypt != nil {
+		if err := c.encrypt.encryptUpload(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	c.progress.emit(ProgressEvent{
+		Type:   ProgressStarted,
+		Bucket: bucket,
+		Key:    key,
+		Total:  total,
+	})
+
 	uploader := s3manager.NewUploader(sess)
+	if c.sent != nil {
+		// The digest has to split the body where the uploader does, and
+		// the uploader cannot size a body read through a tee
+		uploader.PartSize = uploadPartSize(0, readerSize(c.input.Body))
+	}
+	send := func() (*s3manager.UploadOutput, error) {
+		input := c.input
+		if c.sent != nil {
+			*c.sent = *newPartHasher(uploader.PartSize, c.sent.newHash)
+			tee := *c.input
+			tee.Body = io.TeeReader(c.input.Body, c.sent)
+			input = &tee
+		}
+		return uploader.UploadWithContext(ctx, input, s3manager.WithUploaderRequestOptions(c.requestOptions...))
+	}
+	out, requested, err := c.sendWithFallback(send)
+	if pr, ok := c.input.Body.(*io.PipeReader); ok {
+		// Unblock a producer that is still writing after a failed upload
+		pr.Close()
+	}
+	c.progress.finish(bucket, key, err)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	result := &UploadResult{
+		Bucket:                bucket,
+		Key:                   key,
+		Location:              out.Location,
+		VersionID:             aws.StringValue(out.VersionID),
+		ETag:                  aws.StringValue(out.ETag),
+		StorageClass:          aws.StringValue(c.input.StorageClass),
+		RequestedStorageClass: requested,
+	}
+	if c.receipt != nil {
+		if result.ReceiptKey, err = c.receipt.write(ctx, sess, result, sum); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// UploadFile uploads a file to S3 using an existing session and returns the object key
+func UploadFile(ctx context.Context, sess *session.Session, fileName, bucket, folder string, opts ...UploadOption) (string, error) {
+	result, err := UploadFileWithResult(ctx, sess, fileName, bucket, folder, opts...)
+	if err != nil {
+		return "", err
+	}
+	return result.Key, nil
+}
+
+// UploadFileWithResult uploads a file like UploadFile and returns the full upload result
+func UploadFileWithResult(ctx context.Context, sess *session.Session, fileName, bucket, folder string, opts ...UploadOption) (*UploadResult, error) {
+	key := JoinKey(folder, filepath.Base(fileName))
+	return uploadFileToKey(ctx, sess, fileName, bucket, key, opts...)
+}
+
+// UploadReader uploads body to bucket/key with the same options as UploadFile
+func UploadReader(ctx context.Context, sess *session.Session, bucket, key string, body io.Reader, opts ...UploadOption) (*UploadResult, error) {
+	return newUploadConfig(bucket, key, body, opts).upload(ctx, sess)
+}
 
+// uploadFileToKey uploads a file to an explicit key
+func uploadFileToKey(ctx context.Context, sess *session.Session, fileName, bucket, key string, opts ...UploadOption) (*UploadResult, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
-	key := filepath.Join(folder, filepath.Base(fileName))
+	cfg := newUploadConfig(bucket, key, file, opts)
+	return cfg.upload(ctx, sess)
+}
 
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   file,
-	})
+// downloadConfig holds the state that DownloadOptions act on
+type downloadConfig struct {
+	input          *s3.GetObjectInput
+	decompress     bool
+	decrypt        *EnvelopeEncryption
+	keyHash        string
+	requestOptions []request.Option
+	progress       ProgressSink
+}
+
+// DownloadOption customizes a download performed by DownloadFile
+type DownloadOption func(*downloadConfig)
+
+// WithDownloadInput applies fn to the GetObject input before it is sent
+func WithDownloadInput(fn func(*s3.GetObjectInput)) DownloadOption {
+	return func(c *downloadConfig) {
+		fn(c.input)
+	}
+}
+
+// DownloadFile downloads an object from S3 to localPath
+func DownloadFile(ctx context.Context, sess *session.Session, bucket, key, localPath string, opts ...DownloadOption) error {
+	cfg := &downloadConfig{
+		input: &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	file, err := os.Create(localPath)
 	if err != nil {
 		return err
 	}
+
+	cfg.progress.emit(ProgressEvent{Type: ProgressStarted, Bucket: bucket, Key: key})
+	// Object Lambda functions are not required to support ranged GETs
+	if cfg.decompress || cfg.decrypt != nil || cfg.keyHash != "" || IsObjectLambdaARN(bucket) {
+		err = streamDownload(ctx, sess, cfg, file)
+	} else {
+		downloader := s3manager.NewDownloader(sess)
+		_, err = downloader.DownloadWithContext(ctx, file, cfg.input, s3manager.WithDownloaderRequestOptions(cfg.requestOptions...))
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	cfg.progress.finish(bucket, key, err)
+	if err != nil {
+		os.Remove(localPath)
+		return wrapError(err)
+	}
+	return nil
+}
+
+// streamDownload reads the object sequentially through the configured
+// decryption and decompression into w, verifying the key hash if requested
+func streamDownload(ctx context.Context, sess *session.Session, cfg *downloadConfig, w io.Writer) error {
+	var verifier *keyHashVerifier
+	if cfg.keyHash != "" {
+		var err error
+		if verifier, err = newKeyHashVerifier(cfg.keyHash, aws.StringValue(cfg.input.Key)); err != nil {
+			return err
+		}
+	}
+
+	svc := s3.New(sess)
+	out, err := svc.GetObjectWithContext(ctx, cfg.input, cfg.requestOptions...)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer out.Body.Close()
+
+	var r io.Reader = out.Body
+	if cfg.decrypt != nil {
+		plain, err := cfg.decrypt.decryptReader(ctx, out.Metadata, r)
+		if err != nil {
+			return err
+		}
+		defer plain.Close()
+		r = plain
+	}
+	if cfg.decompress {
+		rc, err := decompressReader(aws.StringValue(cfg.input.Key), out, r)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		r = rc
+	}
+	if verifier != nil {
+		w = io.MultiWriter(w, verifier)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return wrapError(err)
+	}
+	if verifier != nil {
+		return verifier.verify(aws.StringValue(cfg.input.Bucket), aws.StringValue(cfg.input.Key))
+	}
 	return nil
 }
 
 // NewAWSSession creates a new AWS session
-func NewAWSSession(region, profile string) (*session.Session, error) {
-	return session.NewSessionWithOptions(session.Options{
-		Config:            aws.Config{Region: aws.String(region)},
-		Profile:           profile,
-		SharedConfigState: session.SharedConfigEnable,
-	})
+func NewAWSSession(region, profile string, opts ...SessionOption) (*session.Session, error) {
+	return newSession(aws.Config{Region: aws.String(region)}, profile, opts)
+}
+
+// copySource builds the URL-encoded CopySource value for bucket/key
+func copySource(bucket, key string) string {
+	return url.PathEscape(bucket) + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// NewAWSSessionWithEndpoint creates a new AWS session against a custom
+// S3-compatible endpoint. Path-style addressing is used so that endpoints
+// without virtual-host bucket DNS work.
+func NewAWSSessionWithEndpoint(region, profile, endpoint string, opts ...SessionOption) (*session.Session, error) {
+	if endpoint == "" {
+		return NewAWSSession(region, profile, opts...)
+	}
+	return newSession(aws.Config{
+		Region:           aws.String(region),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+	}, profile, opts)
 }
@@ -0,0 +1,243 @@
+package s3utils
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// SaltingOptions configures hot-prefix detection for a KeySalter
+type SaltingOptions struct {
+	// Threshold is the number of requests within Window that marks a prefix as hot
+	Threshold int
+	// Window is the sliding window used to measure the request rate
+	Window time.Duration
+	// Partitions is the number of salted sub-prefixes keys are spread across
+	Partitions int
+	// MaxMappings bounds the salted keys kept in memory. The least recently
+	// used ones are evicted first and no longer resolve, so save the mapping
+	// with SaveMapping if every salted key must stay resolvable.
+	MaxMappings int
+}
+
+// DefaultSaltingOptions returns options tuned below the S3 per-prefix PUT limit
+func DefaultSaltingOptions() SaltingOptions {
+	return SaltingOptions{
+		Threshold:   3000,
+		Window:      time.Second,
+		Partitions:  16,
+		MaxMappings: 100000,
+	}
+}
+
+// KeySalter detects prefixes receiving a high request rate and salts new
+// keys under them across sub-prefixes. Every salted key is recorded so
+// readers can map the original key to the stored one.
+type KeySalter struct {
+	opts SaltingOptions
+
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+	mapping   map[string]*list.Element
+	// recent orders the mapping from most to least recently used
+	recent *list.List
+	now    func() time.Time
+}
+
+// saltedKey is a mapping entry of a KeySalter
+type saltedKey struct {
+	key, salted string
+}
+
+// NewKeySalter creates a KeySalter. Zero fields in opts fall back to DefaultSaltingOptions.
+func NewKeySalter(opts SaltingOptions) *KeySalter {
+	def := DefaultSaltingOptions()
+	if opts.Threshold <= 0 {
+		opts.Threshold = def.Threshold
+	}
+	if opts.Window <= 0 {
+		opts.Window = def.Window
+	}
+	if opts.Partitions <= 0 {
+		opts.Partitions = def.Partitions
+	}
+	if opts.MaxMappings <= 0 {
+		opts.MaxMappings = def.MaxMappings
+	}
+	return &KeySalter{
+		opts:    opts,
+		hits:    make(map[string][]time.Time),
+		mapping: make(map[string]*list.Element),
+		recent:  list.New(),
+		now:     time.Now,
+	}
+}
+
+// record registers a request against prefix and reports whether the prefix is hot
+func (s *KeySalter) record(prefix string) bool {
+	now := s.now()
+	cutoff := now.Add(-s.opts.Window)
+
+	hits := s.hits[prefix]
+	i := 0
+	for i < len(hits) && hits[i].Before(cutoff) {
+		i++
+	}
+	hits = append(hits[i:], now)
+	s.hits[prefix] = hits
+
+	// Once per window, forget prefixes that have gone quiet
+	if now.Sub(s.lastSweep) >= s.opts.Window {
+		for p, h := range s.hits {
+			if h[len(h)-1].Before(cutoff) {
+				delete(s.hits, p)
+			}
+		}
+		s.lastSweep = now
+	}
+	return len(hits) > s.opts.Threshold
+}
+
+// lookup returns the salted key recorded for key and marks it recently used
+func (s *KeySalter) lookup(key string) (string, bool) {
+	e, ok := s.mapping[key]
+	if !ok {
+		return "", false
+	}
+	s.recent.MoveToFront(e)
+	return e.Value.(*saltedKey).salted, true
+}
+
+// store records the salted key for key, evicting the least recently used
+// entries beyond MaxMappings
+func (s *KeySalter) store(key, salted string) {
+	if e, ok := s.mapping[key]; ok {
+		e.Value.(*saltedKey).salted = salted
+		s.recent.MoveToFront(e)
+		return
+	}
+	s.mapping[key] = s.recent.PushFront(&saltedKey{key: key, salted: salted})
+	for s.recent.Len() > s.opts.MaxMappings {
+		oldest := s.recent.Remove(s.recent.Back()).(*saltedKey)
+		delete(s.mapping, oldest.key)
+	}
+}
+
+// IsHot reports whether prefix is currently above the request rate threshold
+func (s *KeySalter) IsHot(prefix string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-s.opts.Window)
+	n := 0
+	for _, t := range s.hits[prefix] {
+		if !t.Before(cutoff) {
+			n++
+		}
+	}
+	return n > s.opts.Threshold
+}
+
+// SaltKey records a write to key and returns the key to store it under.
+// Keys under a hot prefix are rewritten to prefix/<salt>/name.
+func (s *KeySalter) SaltKey(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if salted, ok := s.lookup(key); ok {
+		return salted
+	}
+
+	prefix, name := path.Split(key)
+	if !s.record(prefix) {
+		return key
+	}
+
+	salt := crc32.ChecksumIEEE([]byte(key)) % uint32(s.opts.Partitions)
+	salted := fmt.Sprintf("%s%02x/%s", prefix, salt, name)
+	s.store(key, salted)
+	return salted
+}
+
+// Resolve returns the stored key for an original key
+func (s *KeySalter) Resolve(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if salted, ok := s.lookup(key); ok {
+		return salted
+	}
+	return key
+}
+
+// Mapping returns a copy of the original-to-salted key mapping
+func (s *KeySalter) Mapping() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := make(map[string]string, len(s.mapping))
+	for k, e := range s.mapping {
+		m[k] = e.Value.(*saltedKey).salted
+	}
+	return m
+}
+
+// SaveMapping writes the key mapping as a JSON object to bucket/key
+func (s *KeySalter) SaveMapping(ctx context.Context, sess *session.Session, bucket, key string) error {
+	data, err := json.Marshal(s.Mapping())
+	if err != nil {
+		return err
+	}
+	svc := s3.New(sess)
+	_, err = svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}, internalWrite)
+	return wrapError(err)
+}
+
+// LoadMapping merges a mapping previously written by SaveMapping
+func (s *KeySalter) LoadMapping(ctx context.Context, sess *session.Session, bucket, key string) error {
+	svc := s3.New(sess)
+	out, err := svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	defer out.Body.Close()
+
+	var m map[string]string
+	if err := json.NewDecoder(out.Body).Decode(&m); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range m {
+		s.store(k, v)
+	}
+	return nil
+}
+
+// WithKeySalter salts the upload key through s when its prefix is hot
+func WithKeySalter(s *KeySalter) UploadOption {
+	return WithUploadInput(func(in *s3manager.UploadInput) {
+		in.Key = aws.String(s.SaltKey(aws.StringValue(in.Key)))
+	})
+}
@@ -0,0 +1,195 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Grantee URIs that make an ACL grant public
+const (
+	allUsersURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// PublicAccessBlock mirrors the bucket-level public access block settings
+type PublicAccessBlock struct {
+	Configured            bool
+	BlockPublicACLs       bool
+	IgnorePublicACLs      bool
+	BlockPublicPolicy     bool
+	RestrictPublicBuckets bool
+}
+
+// FullyBlocked reports whether all four public access block settings are enabled
+func (p PublicAccessBlock) FullyBlocked() bool {
+	return p.BlockPublicACLs && p.IgnorePublicACLs && p.BlockPublicPolicy && p.RestrictPublicBuckets
+}
+
+// SecuritySummary is the effective security posture of a bucket
+type SecuritySummary struct {
+	Bucket            string
+	PublicAccessBlock PublicAccessBlock
+	HasPolicy         bool
+	PolicyIsPublic    bool
+	// ACLsDisabled is true when object ownership is BucketOwnerEnforced
+	ACLsDisabled bool
+	// PublicACLGrants lists ACL permissions granted to everyone or any AWS user
+	PublicACLGrants []string
+	// Encryption is the default encryption algorithm, empty if none is configured
+	Encryption string
+	// Versioning is Enabled, Suspended or empty if never enabled
+	Versioning string
+	Warnings   []string
+}
+
+// PubliclyReadable reports whether the policy or ACL grants public access
+// that is not neutralized by the public access block
+func (s *SecuritySummary) PubliclyReadable() bool {
+	pab := s.PublicAccessBlock
+	if s.PolicyIsPublic && !pab.RestrictPublicBuckets {
+		return true
+	}
+	return len(s.PublicACLGrants) > 0 && !s.ACLsDisabled && !pab.IgnorePublicACLs
+}
+
+// String renders the summary as a short human-readable report
+func (s *SecuritySummary) String() string {
+	var b strings.Builder
+	yesNo := func(v bool) string {
+		if v {
+			return "yes"
+		}
+		return "no"
+	}
+	orNone := func(v string) string {
+		if v == "" {
+			return "none"
+		}
+		return v
+	}
+
+	fmt.Fprintf(&b, "bucket:              %s\n", s.Bucket)
+	if s.PublicAccessBlock.Configured {
+		fmt.Fprintf(&b, "public access block: %s\n", yesNo(s.PublicAccessBlock.FullyBlocked()))
+	} else {
+		fmt.Fprintf(&b, "public access block: not configured\n")
+	}
+	fmt.Fprintf(&b, "bucket policy:       %s (public: %s)\n", yesNo(s.HasPolicy), yesNo(s.PolicyIsPublic))
+	fmt.Fprintf(&b, "ACLs disabled:       %s\n", yesNo(s.ACLsDisabled))
+	fmt.Fprintf(&b, "public ACL grants:   %s\n", orNone(strings.Join(s.PublicACLGrants, ", ")))
+	fmt.Fprintf(&b, "default encryption:  %s\n", orNone(s.Encryption))
+	fmt.Fprintf(&b, "versioning:          %s\n", orNone(s.Versioning))
+	for _, w := range s.Warnings {
+		fmt.Fprintf(&b, "WARNING: %s\n", w)
+	}
+	return b.String()
+}
+
+// AnalyzeBucketSecurity combines the bucket policy status, ACL, public access
+// block, ownership, encryption and versioning settings into a summary with warnings
+func AnalyzeBucketSecurity(ctx context.Context, sess *session.Session, bucket string) (*SecuritySummary, error) {
+	svc := s3.New(sess)
+	s := &SecuritySummary{Bucket: bucket}
+	b := aws.String(bucket)
+
+	pab, err := svc.GetPublicAccessBlockWithContext(ctx, &s3.GetPublicAccessBlockInput{Bucket: b})
+	if err != nil {
+		if err := ignoreCodes(err, "NoSuchPublicAccessBlockConfiguration"); err != nil {
+			return nil, err
+		}
+	} else if c := pab.PublicAccessBlockConfiguration; c != nil {
+		s.PublicAccessBlock = PublicAccessBlock{
+			Configured:            true,
+			BlockPublicACLs:       aws.BoolValue(c.BlockPublicAcls),
+			IgnorePublicACLs:      aws.BoolValue(c.IgnorePublicAcls),
+			BlockPublicPolicy:     aws.BoolValue(c.BlockPublicPolicy),
+			RestrictPublicBuckets: aws.BoolValue(c.RestrictPublicBuckets),
+		}
+	}
+
+	status, err := svc.GetBucketPolicyStatusWithContext(ctx, &s3.GetBucketPolicyStatusInput{Bucket: b})
+	if err != nil {
+		if err := ignoreCodes(err, "NoSuchBucketPolicy"); err != nil {
+			return nil, err
+		}
+	} else {
+		s.HasPolicy = true
+		s.PolicyIsPublic = status.PolicyStatus != nil && aws.BoolValue(status.PolicyStatus.IsPublic)
+	}
+
+	ownership, err := svc.GetBucketOwnershipControlsWithContext(ctx, &s3.GetBucketOwnershipControlsInput{Bucket: b})
+	if err != nil {
+		if err := ignoreCodes(err, "OwnershipControlsNotFoundError"); err != nil {
+			return nil, err
+		}
+	} else if ownership.OwnershipControls != nil {
+		for _, r := range ownership.OwnershipControls.Rules {
+			if aws.StringValue(r.ObjectOwnership) == s3.ObjectOwnershipBucketOwnerEnforced {
+				s.ACLsDisabled = true
+			}
+		}
+	}
+
+	acl, err := svc.GetBucketAclWithContext(ctx, &s3.GetBucketAclInput{Bucket: b})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	for _, g := range acl.Grants {
+		if g.Grantee == nil {
+			continue
+		}
+		switch aws.StringValue(g.Grantee.URI) {
+		case allUsersURI:
+			s.PublicACLGrants = append(s.PublicACLGrants, "AllUsers:"+aws.StringValue(g.Permission))
+		case authenticatedUsersURI:
+			s.PublicACLGrants = append(s.PublicACLGrants, "AuthenticatedUsers:"+aws.StringValue(g.Permission))
+		}
+	}
+
+	enc, err := svc.GetBucketEncryptionWithContext(ctx, &s3.GetBucketEncryptionInput{Bucket: b})
+	if err != nil {
+		if err := ignoreCodes(err, "ServerSideEncryptionConfigurationNotFoundError"); err != nil {
+			return nil, err
+		}
+	} else if enc.ServerSideEncryptionConfiguration != nil {
+		for _, r := range enc.ServerSideEncryptionConfiguration.Rules {
+			if r.ApplyServerSideEncryptionByDefault != nil {
+				s.Encryption = aws.StringValue(r.ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+			}
+		}
+	}
+
+	ver, err := svc.GetBucketVersioningWithContext(ctx, &s3.GetBucketVersioningInput{Bucket: b})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	s.Versioning = aws.StringValue(ver.Status)
+
+	s.Warnings = securityWarnings(s)
+	return s, nil
+}
+
+func securityWarnings(s *SecuritySummary) []string {
+	var warnings []string
+	if s.PubliclyReadable() {
+		warnings = append(warnings, "bucket contents are publicly accessible")
+	}
+	if !s.PublicAccessBlock.FullyBlocked() {
+		warnings = append(warnings, "public access block is not fully enabled")
+	}
+	if len(s.PublicACLGrants) > 0 && !s.ACLsDisabled {
+		warnings = append(warnings, "bucket ACL grants access to everyone or to any AWS user")
+	}
+	if s.Encryption == "" {
+		warnings = append(warnings, "no default encryption configured")
+	}
+	if s.Versioning != s3.BucketVersioningStatusEnabled {
+		warnings = append(warnings, "versioning is not enabled")
+	}
+	return warnings
+}
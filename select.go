@@ -0,0 +1,181 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// SelectFormat is the serialization format of an object queried with S3 Select
+type SelectFormat string
+
+// Supported S3 Select formats
+const (
+	SelectCSV     SelectFormat = "CSV"
+	SelectJSON    SelectFormat = "JSON"
+	SelectParquet SelectFormat = "Parquet"
+)
+
+// SelectQuery describes an S3 Select request
+type SelectQuery struct {
+	Bucket     string
+	Key        string
+	Expression string
+
+	// InputFormat is the format of the stored object
+	InputFormat SelectFormat
+	// OutputFormat is the format of the returned rows, CSV or JSON. Defaults to JSON.
+	OutputFormat SelectFormat
+	// CSVHeader treats the first CSV line as a header so columns can be referenced by name
+	CSVHeader bool
+	// Compression is the object compression: NONE, GZIP or BZIP2
+	Compression string
+
+	// OnProgress is called for every progress event sent by S3
+	OnProgress func(SelectStats)
+}
+
+// SelectStats holds the byte counters reported by S3 Select
+type SelectStats struct {
+	BytesScanned   int64
+	BytesProcessed int64
+	BytesReturned  int64
+}
+
+func (q *SelectQuery) input() (*s3.SelectObjectContentInput, error) {
+	in := &s3.InputSerialization{}
+	switch q.InputFormat {
+	case SelectCSV:
+		in.CSV = &s3.CSVInput{}
+		if q.CSVHeader {
+			in.CSV.FileHeaderInfo = aws.String(s3.FileHeaderInfoUse)
+		}
+	case SelectJSON:
+		in.JSON = &s3.JSONInput{Type: aws.String(s3.JSONTypeLines)}
+	case SelectParquet:
+		in.Parquet = &s3.ParquetInput{}
+	default:
+		return nil, fmt.Errorf("s3utils: unsupported select input format %q", q.InputFormat)
+	}
+	if q.Compression != "" {
+		in.CompressionType = aws.String(q.Compression)
+	}
+
+	out := &s3.OutputSerialization{}
+	switch q.OutputFormat {
+	case SelectCSV:
+		out.CSV = &s3.CSVOutput{}
+	case SelectJSON, "":
+		out.JSON = &s3.JSONOutput{RecordDelimiter: aws.String("\n")}
+	default:
+		return nil, fmt.Errorf("s3utils: unsupported select output format %q", q.OutputFormat)
+	}
+
+	return &s3.SelectObjectContentInput{
+		Bucket:              aws.String(q.Bucket),
+		Key:                 aws.String(q.Key),
+		Expression:          aws.String(q.Expression),
+		ExpressionType:      aws.String(s3.ExpressionTypeSql),
+		InputSerialization:  in,
+		OutputSerialization: out,
+	}, nil
+}
+
+func statsFrom(scanned, processed, returned *int64) SelectStats {
+	return SelectStats{
+		BytesScanned:   aws.Int64Value(scanned),
+		BytesProcessed: aws.Int64Value(processed),
+		BytesReturned:  aws.Int64Value(returned),
+	}
+}
+
+// SelectObject runs an S3 Select query and streams the raw result records to w
+func SelectObject(ctx context.Context, sess *session.Session, q SelectQuery, w io.Writer) (*SelectStats, error) {
+	input, err := q.input()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := s3.New(sess)
+	out, err := svc.SelectObjectContentWithContext(ctx, input)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	stream := out.GetStream()
+	defer stream.Close()
+
+	stats := &SelectStats{}
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *s3.RecordsEvent:
+			if _, err := w.Write(e.Payload); err != nil {
+				return stats, err
+			}
+		case *s3.ProgressEvent:
+			if q.OnProgress != nil && e.Details != nil {
+				q.OnProgress(statsFrom(e.Details.BytesScanned, e.Details.BytesProcessed, e.Details.BytesReturned))
+			}
+		case *s3.StatsEvent:
+			if e.Details != nil {
+				*stats = statsFrom(e.Details.BytesScanned, e.Details.BytesProcessed, e.Details.BytesReturned)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return stats, wrapError(err)
+	}
+	return stats, nil
+}
+
+// rowWriter splits written records on newlines and sends each row to a channel
+type rowWriter struct {
+	ctx  context.Context
+	rows chan<- []byte
+	buf  []byte
+}
+
+func (r *rowWriter) Write(p []byte) (int, error) {
+	r.buf = append(r.buf, p...)
+	for {
+		i := bytes.IndexByte(r.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := r.send(r.buf[:i]); err != nil {
+			return 0, err
+		}
+		r.buf = r.buf[i+1:]
+	}
+}
+
+func (r *rowWriter) send(row []byte) error {
+	select {
+	case r.rows <- append([]byte(nil), row...):
+		return nil
+	case <-r.ctx.Done():
+		return r.ctx.Err()
+	}
+}
+
+// SelectObjectRows runs an S3 Select query and sends each result row to rows.
+// The rows channel is closed when the query finishes.
+func SelectObjectRows(ctx context.Context, sess *session.Session, q SelectQuery, rows chan<- []byte) (*SelectStats, error) {
+	defer close(rows)
+
+	w := &rowWriter{ctx: ctx, rows: rows}
+	stats, err := SelectObject(ctx, sess, q, w)
+	if err != nil {
+		return stats, err
+	}
+	if len(w.buf) > 0 {
+		if err := w.send(w.buf); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,234 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// DefaultShardReplicas is the number of virtual nodes placed on the ring per bucket
+const DefaultShardReplicas = 128
+
+// hashRing is a consistent hash ring mapping keys to bucket names
+type hashRing struct {
+	hashes  []uint32
+	buckets map[uint32]string
+}
+
+func newHashRing(buckets []string, replicas int) *hashRing {
+	r := &hashRing{buckets: make(map[uint32]string)}
+	for _, b := range buckets {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + "#" + b))
+			r.hashes = append(r.hashes, h)
+			r.buckets[h] = b
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+func (r *hashRing) get(key string) string {
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.buckets[r.hashes[i]]
+}
+
+// ShardedClient distributes object keys across multiple buckets using consistent hashing
+type ShardedClient struct {
+	sess    *session.Session
+	svc     *s3.S3
+	buckets []string
+	ring    *hashRing
+}
+
+// NewShardedClient creates a ShardedClient over the given buckets.
+// A replicas value of 0 or less uses DefaultShardReplicas.
+func NewShardedClient(sess *session.Session, buckets []string, replicas int) (*ShardedClient, error) {
+	if len(buckets) == 0 {
+		return nil, errors.New("s3utils: at least one bucket is required")
+	}
+	if replicas <= 0 {
+		replicas = DefaultShardReplicas
+	}
+	return &ShardedClient{
+		sess:    sess,
+		svc:     s3.New(sess),
+		buckets: append([]string(nil), buckets...),
+		ring:    newHashRing(buckets, replicas),
+	}, nil
+}
+
+// Buckets returns the buckets in the shard set
+func (c *ShardedClient) Buckets() []string {
+	return append([]string(nil), c.buckets...)
+}
+
+// BucketFor returns the bucket that owns the given key
+func (c *ShardedClient) BucketFor(key string) string {
+	return c.ring.get(key)
+}
+
+// locate returns the bucket currently holding key. The owning bucket is
+// checked first; the remaining buckets are probed so that keys which have
+// not been rebalanced yet are still readable.
+func (c *ShardedClient) locate(ctx context.Context, key string) (string, error) {
+	owner := c.BucketFor(key)
+	exists, err := objectExists(ctx, c.svc, owner, key, "")
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return owner, nil
+	}
+	for _, b := range c.buckets {
+		if b == owner {
+			continue
+		}
+		exists, err := objectExists(ctx, c.svc, b, key, "")
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return b, nil
+		}
+	}
+	return "", nil
+}
+
+// Exists checks if the key exists in any bucket of the shard set
+func (c *ShardedClient) Exists(ctx context.Context, key string) (bool, error) {
+	bucket, err := c.locate(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return bucket != "", nil
+}
+
+// Upload uploads a file to the bucket owning folder/<base name> and returns the bucket and key
+func (c *ShardedClient) Upload(ctx context.Context, fileName, folder string) (string, string, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	key := JoinKey(folder, filepath.Base(fileName))
+	bucket := c.BucketFor(key)
+
+	if _, err := newUploadConfig(bucket, key, file, nil).upload(ctx, c.sess); err != nil {
+		return "", "", err
+	}
+	return bucket, key, nil
+}
+
+// Download downloads the key to localPath from whichever bucket holds it.
+// An existing file at localPath is only replaced once the download is complete.
+func (c *ShardedClient) Download(ctx context.Context, key, localPath string) error {
+	bucket, err := c.locate(ctx, key)
+	if err != nil {
+		return err
+	}
+	if bucket == "" {
+		bucket = c.BucketFor(key)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	downloader := s3manager.NewDownloader(c.sess)
+	_, err = downloader.DownloadWithContext(ctx, tmp, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return wrapError(err)
+	}
+	return os.Rename(tmp.Name(), localPath)
+}
+
+// Delete deletes the key from whichever bucket holds it
+func (c *ShardedClient) Delete(ctx context.Context, key string) error {
+	bucket, err := c.locate(ctx, key)
+	if err != nil || bucket == "" {
+		return err
+	}
+	_, err = c.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return wrapError(err)
+}
+
+// RebalanceReport summarizes the work done by Rebalance
+type RebalanceReport struct {
+	Scanned int
+	Moved   int
+}
+
+// Rebalance moves every object that is not stored in its owning bucket.
+// Buckets that have been removed from the shard set can be passed as
+// drain so their objects are moved into the current set as well.
+func (c *ShardedClient) Rebalance(ctx context.Context, drain ...string) (*RebalanceReport, error) {
+	report := &RebalanceReport{}
+	sources := append(c.Buckets(), drain...)
+
+	for _, src := range sources {
+		var moveErr error
+		err := c.svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(src),
+		}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, obj := range page.Contents {
+				report.Scanned++
+				key := aws.StringValue(obj.Key)
+				dst := c.BucketFor(key)
+				if dst == src {
+					continue
+				}
+				if moveErr = c.move(ctx, src, dst, key); moveErr != nil {
+					return false
+				}
+				report.Moved++
+			}
+			return true
+		})
+		if moveErr != nil {
+			return report, moveErr
+		}
+		if err != nil {
+			return report, wrapError(err)
+		}
+	}
+	return report, nil
+}
+
+// move server-side copies key from src to dst, verifying its checksum, and
+// deletes the source object
+func (c *ShardedClient) move(ctx context.Context, src, dst, key string) error {
+	if _, err := copyVerified(ctx, c.svc, src, key, dst, key); err != nil {
+		return err
+	}
+	_, err := c.svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(src),
+		Key:    aws.String(key),
+	})
+	return wrapError(err)
+}
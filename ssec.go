@@ -0,0 +1,167 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// SSECRotationOptions configures RotateSSECKey
+type SSECRotationOptions struct {
+	// CheckpointFile records the last fully processed key so an interrupted
+	// rotation resumes where it stopped. Empty disables checkpointing.
+	CheckpointFile string
+	// Concurrency is the number of parallel copies. Zero uses DefaultConcurrency.
+	Concurrency int
+	// OnProgress is called after every object is processed
+	OnProgress func(SSECRotationReport)
+}
+
+// SSECRotationReport counts the objects handled by RotateSSECKey
+type SSECRotationReport struct {
+	Scanned int
+	Rotated int
+	// Skipped objects were already encrypted with the new key
+	Skipped int
+}
+
+// WithSSECustomerKey encrypts the uploaded object with a customer-provided AES-256 key
+func WithSSECustomerKey(key []byte) UploadOption {
+	return func(c *uploadConfig) {
+		c.input.SSECustomerAlgorithm = aws.String("AES256")
+		c.input.SSECustomerKey = aws.String(string(key))
+	}
+}
+
+// WithSSECustomerKeyDownload decrypts the downloaded object with a customer-provided AES-256 key
+func WithSSECustomerKeyDownload(key []byte) DownloadOption {
+	return WithDownloadInput(func(in *s3.GetObjectInput) {
+		in.SSECustomerAlgorithm = aws.String("AES256")
+		in.SSECustomerKey = aws.String(string(key))
+	})
+}
+
+// RotateSSECKey re-encrypts every SSE-C object under prefix from oldKey to
+// newKey by copying each object onto itself. Objects that already use
+// newKey are skipped, so the rotation can be safely re-run; with a
+// checkpoint file it also resumes without re-listing finished keys.
+func RotateSSECKey(ctx context.Context, sess *session.Session, bucket, prefix string, oldKey, newKey []byte, opts SSECRotationOptions) (*SSECRotationReport, error) {
+	if len(oldKey) != 32 || len(newKey) != 32 {
+		return nil, errors.New("s3utils: SSE-C keys must be 32 bytes")
+	}
+
+	svc := s3.New(sess)
+	report := &SSECRotationReport{}
+	var mu sync.Mutex
+
+	startAfter := ""
+	if opts.CheckpointFile != "" {
+		data, err := os.ReadFile(opts.CheckpointFile)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		startAfter = strings.TrimSpace(string(data))
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(startAfter)
+	}
+
+	rotate := func(ctx context.Context, key string) error {
+		rotated, err := rotateSSECObject(ctx, svc, bucket, key, oldKey, newKey)
+		if err != nil {
+			return fmt.Errorf("s3utils: rotate %s: %w", key, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if rotated {
+			report.Rotated++
+		} else {
+			report.Skipped++
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(*report)
+		}
+		return nil
+	}
+
+	var pageErr error
+	err := svc.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		keys := make([]string, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		mu.Lock()
+		report.Scanned += len(keys)
+		mu.Unlock()
+
+		if pageErr = runParallel(ctx, opts.Concurrency, keys, rotate); pageErr != nil {
+			return false
+		}
+		if opts.CheckpointFile != "" && len(keys) > 0 {
+			if pageErr = os.WriteFile(opts.CheckpointFile, []byte(keys[len(keys)-1]), 0o600); pageErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if pageErr != nil {
+		return report, pageErr
+	}
+	if err != nil {
+		return report, wrapError(err)
+	}
+
+	if opts.CheckpointFile != "" {
+		if err := os.Remove(opts.CheckpointFile); err != nil && !os.IsNotExist(err) {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// rotateSSECObject copies key onto itself with newKey and reports whether a copy was made
+func rotateSSECObject(ctx context.Context, svc *s3.S3, bucket, key string, oldKey, newKey []byte) (bool, error) {
+	_, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       aws.String(string(newKey)),
+	})
+	if err == nil {
+		return false, nil
+	}
+	// S3 answers a HEAD with the wrong customer key with 400 or 403; anything
+	// else, such as a deleted object, is a real failure
+	var rf awserr.RequestFailure
+	if !errors.As(err, &rf) || rf.StatusCode() != http.StatusBadRequest && rf.StatusCode() != http.StatusForbidden {
+		return false, wrapError(err)
+	}
+
+	err = copyObject(ctx, svc, bucket, key, &s3.CopyObjectInput{
+		Bucket:                         aws.String(bucket),
+		Key:                            aws.String(key),
+		MetadataDirective:              aws.String(s3.MetadataDirectiveCopy),
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       aws.String(string(oldKey)),
+		SSECustomerAlgorithm:           aws.String("AES256"),
+		SSECustomerKey:                 aws.String(string(newKey)),
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
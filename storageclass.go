@@ -0,0 +1,131 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Storage classes accepted by WithStorageClass and ChangeStorageClass
+const (
+	StorageClassStandard           = s3.StorageClassStandard
+	StorageClassStandardIA         = s3.StorageClassStandardIa
+	StorageClassOneZoneIA          = s3.StorageClassOnezoneIa
+	StorageClassIntelligentTiering = s3.StorageClassIntelligentTiering
+	StorageClassGlacierIR          = s3.StorageClassGlacierIr
+	StorageClassGlacier            = s3.StorageClassGlacier
+	StorageClassDeepArchive        = s3.StorageClassDeepArchive
+)
+
+// Restore tiers accepted by RestoreFromGlacier
+const (
+	RestoreTierExpedited = s3.TierExpedited
+	RestoreTierStandard  = s3.TierStandard
+	RestoreTierBulk      = s3.TierBulk
+)
+
+// WithStorageClass stores the uploaded object in the given storage class
+func WithStorageClass(class string) UploadOption {
+	return WithUploadInput(func(in *s3manager.UploadInput) {
+		in.StorageClass = aws.String(class)
+	})
+}
+
+// ChangeStorageClass moves an existing object to another storage class by
+// copying it onto itself. The object keeps its server-side encryption.
+func ChangeStorageClass(ctx context.Context, sess *session.Session, bucket, key, class string) error {
+	svc := s3.New(sess)
+	// A copy is encrypted with the bucket default unless told otherwise
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return wrapError(err)
+	}
+	return copyObject(ctx, svc, bucket, key, &s3.CopyObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		StorageClass:         aws.String(class),
+		MetadataDirective:    aws.String(s3.MetadataDirectiveCopy),
+		ServerSideEncryption: head.ServerSideEncryption,
+		SSEKMSKeyId:          head.SSEKMSKeyId,
+		BucketKeyEnabled:     head.BucketKeyEnabled,
+	})
+}
+
+// RestoreFromGlacier requests a temporary restore of an archived object for
+// the given number of days. A restore that is already in progress is not an error.
+func RestoreFromGlacier(ctx context.Context, sess *session.Session, bucket, key string, days int64, tier string) error {
+	svc := s3.New(sess)
+	_, err := svc.RestoreObjectWithContext(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &s3.RestoreRequest{
+			Days:                 aws.Int64(days),
+			GlacierJobParameters: &s3.GlacierJobParameters{Tier: aws.String(tier)},
+		},
+	})
+	if err != nil {
+		if isAWSErrorCode(err, "RestoreAlreadyInProgress") {
+			return nil
+		}
+		return wrapError(err)
+	}
+	return nil
+}
+
+// RestoreStatus reports whether a restore of key is still running and, once
+// complete, when the restored copy expires
+func RestoreStatus(ctx context.Context, sess *session.Session, bucket, key string) (ongoing bool, expiry time.Time, err error) {
+	svc := s3.New(sess)
+	head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return false, time.Time{}, wrapError(err)
+	}
+
+	// The header looks like: ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+	restore := aws.StringValue(head.Restore)
+	if restore == "" {
+		return false, time.Time{}, fmt.Errorf("s3utils: no restore requested for %s", key)
+	}
+	ongoing = strings.Contains(restore, `ongoing-request="true"`)
+	if _, date, ok := strings.Cut(restore, `expiry-date="`); ok {
+		date, _, _ = strings.Cut(date, `"`)
+		expiry, _ = time.Parse(time.RFC1123, date)
+	}
+	return ongoing, expiry, nil
+}
+
+// minRestorePollInterval is the shortest interval WaitForRestore polls at.
+// Restores take minutes at best, so faster polling only adds requests.
+const minRestorePollInterval = time.Minute
+
+// WaitForRestore polls until a restore of key completes or ctx is done.
+// Intervals below one minute are raised to one minute.
+func WaitForRestore(ctx context.Context, sess *session.Session, bucket, key string, interval time.Duration) error {
+	interval = max(interval, minRestorePollInterval)
+	for {
+		ongoing, _, err := RestoreStatus(ctx, sess, bucket, key)
+		if err != nil {
+			return err
+		}
+		if !ongoing {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
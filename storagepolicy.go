@@ -0,0 +1,99 @@
+package s3utils
+
+import (
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// StorageClassUpload describes an upload a StorageClassRule is evaluated against
+type StorageClassUpload struct {
+	Key string
+	// Size is the body size, or 0 when it cannot be determined before upload
+	Size        int64
+	ContentType string
+}
+
+// StorageClassRule selects Class for uploads matching every predicate that is set
+type StorageClassRule struct {
+	Class string
+	// MinSize and MaxSize bound the body size in bytes; zero means unbounded
+	MinSize int64
+	MaxSize int64
+	// Extensions matches key extensions such as ".bak", case-insensitively
+	Extensions []string
+	// Prefix matches the start of the key
+	Prefix string
+	// ContentTypes matches content type prefixes such as "image/"
+	ContentTypes []string
+	// Match is an additional custom predicate
+	Match func(StorageClassUpload) bool
+}
+
+func (r StorageClassRule) matches(u StorageClassUpload) bool {
+	if r.MinSize > 0 && u.Size < r.MinSize {
+		return false
+	}
+	if r.MaxSize > 0 && u.Size > r.MaxSize {
+		return false
+	}
+	if !strings.HasPrefix(u.Key, r.Prefix) {
+		return false
+	}
+	if len(r.Extensions) > 0 && !matchesAny(strings.ToLower(path.Ext(u.Key)), r.Extensions, func(ext, want string) bool {
+		return ext == strings.ToLower(want)
+	}) {
+		return false
+	}
+	if len(r.ContentTypes) > 0 && !matchesAny(u.ContentType, r.ContentTypes, strings.HasPrefix) {
+		return false
+	}
+	return r.Match == nil || r.Match(u)
+}
+
+func matchesAny(s string, values []string, match func(s, value string) bool) bool {
+	for _, v := range values {
+		if match(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageClassPolicy picks a storage class from ordered rules; the first matching rule wins
+type StorageClassPolicy struct {
+	Rules []StorageClassRule
+	// Default is used when no rule matches. Empty leaves the bucket default.
+	Default string
+}
+
+// Select returns the storage class for u
+func (p StorageClassPolicy) Select(u StorageClassUpload) string {
+	for _, r := range p.Rules {
+		if r.matches(u) {
+			return r.Class
+		}
+	}
+	return p.Default
+}
+
+// WithStorageClassPolicy sets the storage class chosen by p from the key,
+// size and content type of the upload. A class set explicitly by an earlier
+// option such as WithStorageClass is kept.
+func WithStorageClassPolicy(p StorageClassPolicy) UploadOption {
+	return WithUploadInput(func(in *s3manager.UploadInput) {
+		if in.StorageClass != nil {
+			return
+		}
+		class := p.Select(StorageClassUpload{
+			Key:         aws.StringValue(in.Key),
+			Size:        readerSize(in.Body),
+			ContentType: aws.StringValue(in.ContentType),
+		})
+		if class != "" {
+			in.StorageClass = aws.String(class)
+		}
+	})
+}
@@ -0,0 +1,298 @@
+package s3utils
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// SyncOptions configures SyncToS3 and SyncFromS3
+type SyncOptions struct {
+	// Delete removes destination entries that no longer exist in the source
+	Delete bool
+	// Concurrency is the number of parallel transfers. Zero uses DefaultConcurrency.
+	Concurrency int
+	// LocalPaths maps keys to local file names in SyncFromS3. Nil uses
+	// DefaultLocalPathRules.
+	LocalPaths *LocalPathRules
+	// Normalization matches local names with keys in a Unicode
+	// normalization form. NormalizeNone compares them unchanged.
+	Normalization UnicodeNormalization
+	// Case tells SyncFromS3 whether the local file system is case-sensitive.
+	// The zero value detects it.
+	Case CaseSensitivity
+	// CaseRename renames the last segment of keys that would overwrite
+	// another key's file on a case-insensitive file system. Nil fails the
+	// sync with a *CaseConflictError instead.
+	CaseRename NameFormat
+}
+
+// SyncResult reports what a sync changed
+type SyncResult struct {
+	mu sync.Mutex
+
+	Transferred []string
+	Deleted     []string
+	Skipped     int
+}
+
+func (r *SyncResult) addTransferred(name string) {
+	r.mu.Lock()
+	r.Transferred = append(r.Transferred, name)
+	r.mu.Unlock()
+}
+
+// localFile is a regular file found while walking a sync directory
+type localFile struct {
+	path string
+	rel  string
+	info fs.FileInfo
+}
+
+// walkLocal returns every regular file under dir keyed by its slash-separated relative path
+func walkLocal(dir string) (map[string]localFile, error) {
+	files := make(map[string]localFile)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files[rel] = localFile{path: p, rel: rel, info: info}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	return files, err
+}
+
+// listRemote returns every object under prefix keyed by its path relative to prefix
+func listRemote(ctx context.Context, sess *session.Session, bucket, prefix string) (map[string]ObjectInfo, error) {
+	objects := make(map[string]ObjectInfo)
+	base := strings.TrimSuffix(prefix, "/")
+	if base != "" {
+		base += "/"
+	}
+	err := WalkObjects(ctx, sess, bucket, base, func(obj ObjectInfo) bool {
+		rel := strings.TrimPrefix(obj.Key, base)
+		if rel != "" && !strings.HasSuffix(rel, "/") {
+			objects[rel] = obj
+		}
+		return true
+	})
+	return objects, err
+}
+
+// SyncPlan is the work of a sync, computed without transferring anything.
+// Run the Transfers in any order and with any concurrency, then call
+// DeleteStale; SyncToS3 and SyncFromS3 do exactly that.
+type SyncPlan struct {
+	// Transfers copies the new and changed entries
+	Transfers []*TransferTask
+	// Stale lists the object keys or local paths DeleteStale removes. It is
+	// empty unless SyncOptions.Delete is set.
+	Stale []string
+	// Result is updated as transfers complete
+	Result *SyncResult
+
+	deleteStale func(ctx context.Context) error
+}
+
+// DeleteStale removes the Stale entries. Call it only after every transfer succeeded.
+func (p *SyncPlan) DeleteStale(ctx context.Context) error {
+	if len(p.Stale) == 0 {
+		return nil
+	}
+	return p.deleteStale(ctx)
+}
+
+// run executes the plan with up to concurrency workers
+func (p *SyncPlan) run(ctx context.Context, concurrency int) (*SyncResult, error) {
+	if err := RunTasks(ctx, p.Transfers, concurrency); err != nil {
+		return p.Result, err
+	}
+	return p.Result, p.DeleteStale(ctx)
+}
+
+// SyncToS3 uploads new and changed files from localDir to bucket/prefix.
+// A file is considered changed when its size differs or it was modified
+// after the object was last written.
+func SyncToS3(ctx context.Context, sess *session.Session, localDir, bucket, prefix string, opts SyncOptions) (*SyncResult, error) {
+	plan, err := PlanSyncToS3(ctx, sess, localDir, bucket, prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan.run(ctx, opts.Concurrency)
+}
+
+// PlanSyncToS3 compares localDir with bucket/prefix and returns the work
+// SyncToS3 would do. opts.Concurrency is ignored.
+func PlanSyncToS3(ctx context.Context, sess *session.Session, localDir, bucket, prefix string, opts SyncOptions) (*SyncPlan, error) {
+	local, err := walkLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if local, err = normalizeNames(local, opts.Normalization); err != nil {
+		return nil, err
+	}
+	// Reject bad names before any request rather than part way through the batch
+	if err := ValidateBucketName(bucket); err != nil {
+		return nil, err
+	}
+	for rel := range local {
+		if err := ValidateKey(JoinKey(prefix, rel)); err != nil {
+			return nil, err
+		}
+	}
+	remote, err := listRemote(ctx, sess, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if remote, err = normalizeNames(remote, opts.Normalization); err != nil {
+		return nil, err
+	}
+
+	plan := &SyncPlan{Result: &SyncResult{}}
+	done := func(t *TransferTask) { plan.Result.addTransferred(t.Key) }
+	for rel, f := range local {
+		key := JoinKey(prefix, rel)
+		if obj, ok := remote[rel]; ok {
+			if obj.Size == f.info.Size() && !f.info.ModTime().After(obj.LastModified) {
+				plan.Result.Skipped++
+				continue
+			}
+			// Overwrite the existing object even if its key is in another form
+			key = obj.Key
+		}
+		plan.Transfers = append(plan.Transfers, uploadTask(sess, f.path, bucket, key, f.info.Size(), nil, done))
+	}
+
+	if opts.Delete {
+		for rel, obj := range remote {
+			if _, ok := local[rel]; !ok {
+				plan.Stale = append(plan.Stale, obj.Key)
+			}
+		}
+	}
+	plan.deleteStale = func(ctx context.Context) error {
+		if _, err := DeleteObjects(ctx, sess, bucket, plan.Stale); err != nil {
+			return err
+		}
+		plan.Result.Deleted = plan.Stale
+		return nil
+	}
+	return plan, nil
+}
+
+// SyncFromS3 downloads new and changed objects from bucket/prefix to localDir.
+// Downloaded files get the object's modification time so unchanged objects
+// are skipped on the next run.
+func SyncFromS3(ctx context.Context, sess *session.Session, bucket, prefix, localDir string, opts SyncOptions) (*SyncResult, error) {
+	plan, err := PlanSyncFromS3(ctx, sess, bucket, prefix, localDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan.run(ctx, opts.Concurrency)
+}
+
+// PlanSyncFromS3 compares bucket/prefix with localDir and returns the work
+// SyncFromS3 would do. opts.Concurrency is ignored. It fails with an
+// *InsufficientSpaceError when localDir cannot hold the transfers.
+func PlanSyncFromS3(ctx context.Context, sess *session.Session, bucket, prefix, localDir string, opts SyncOptions) (*SyncPlan, error) {
+	remote, err := listRemote(ctx, sess, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	local, err := walkLocal(localDir)
+	if err != nil {
+		return nil, err
+	}
+	if local, err = normalizeNames(local, opts.Normalization); err != nil {
+		return nil, err
+	}
+	if remote, err = normalizeNames(remote, opts.Normalization); err != nil {
+		return nil, err
+	}
+
+	rules := DefaultLocalPathRules
+	if opts.LocalPaths != nil {
+		rules = *opts.LocalPaths
+	}
+	paths, err := rules.localPaths(remote)
+	if err != nil {
+		return nil, err
+	}
+	insensitive, err := opts.Case.insensitive(localDir)
+	if err != nil {
+		return nil, err
+	}
+	fold := func(name string) string { return name }
+	if insensitive {
+		if err := resolveCaseConflicts(remote, paths, opts.CaseRename); err != nil {
+			return nil, err
+		}
+		fold = foldCase
+		folded := make(map[string]localFile, len(local))
+		for rel, f := range local {
+			folded[fold(rel)] = f
+		}
+		local = folded
+	}
+
+	plan := &SyncPlan{Result: &SyncResult{}}
+	done := func(t *TransferTask) { plan.Result.addTransferred(t.LocalPath) }
+	wanted := make(map[string]bool, len(paths))
+	var required int64
+	for rel, obj := range remote {
+		wanted[fold(paths[rel])] = true
+		dst := rules.LocalPath(localDir, paths[rel])
+		if f, ok := local[fold(paths[rel])]; ok {
+			if f.info.Size() == obj.Size && !obj.LastModified.After(f.info.ModTime()) {
+				plan.Result.Skipped++
+				continue
+			}
+			// Overwrite the existing file even if its name is in another form
+			dst = f.path
+			required -= f.info.Size()
+		}
+		plan.Transfers = append(plan.Transfers, downloadTask(sess, bucket, dst, obj, done))
+		required += obj.Size
+	}
+	if err := CheckDiskSpace(localDir, required); err != nil {
+		return nil, err
+	}
+
+	if opts.Delete {
+		for rel, f := range local {
+			if !wanted[rel] {
+				plan.Stale = append(plan.Stale, f.path)
+			}
+		}
+	}
+	plan.deleteStale = func(context.Context) error {
+		for _, p := range plan.Stale {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+			plan.Result.Deleted = append(plan.Result.Deleted, p)
+		}
+		return nil
+	}
+	return plan, nil
+}
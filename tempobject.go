@@ -0,0 +1,94 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// TempObjectsPrefix is the prefix PutTempObject writes to
+const TempObjectsPrefix = "_tmp/"
+
+// TempExpiresTag is the object tag holding a temporary object's expiry time in RFC 3339
+const TempExpiresTag = "s3utils-expires-at"
+
+// PutTempObject uploads body to TempObjectsPrefix/name, tagged with the time
+// ttl from now after which it may be discarded. Objects are removed by
+// CleanupTempObjects, or by a lifecycle rule on TempObjectsPrefix.
+func PutTempObject(ctx context.Context, sess *session.Session, bucket, name string, body io.Reader, ttl time.Duration, opts ...UploadOption) (*UploadResult, error) {
+	expires := time.Now().Add(ttl).UTC().Format(time.RFC3339)
+	tagging := url.Values{TempExpiresTag: {expires}}.Encode()
+	opts = append([]UploadOption{WithUploadInput(func(in *s3manager.UploadInput) {
+		in.Tagging = aws.String(tagging)
+	})}, opts...)
+	return newUploadConfig(bucket, TempObjectsPrefix+strings.TrimPrefix(name, "/"), body, opts).upload(ctx, sess)
+}
+
+// CleanupTempObjects deletes the objects under TempObjectsPrefix whose TTL
+// has passed, and any written more than olderThan ago regardless of their
+// tag. It returns how many were deleted.
+func CleanupTempObjects(ctx context.Context, sess *session.Session, bucket string, olderThan time.Duration) (int, error) {
+	now := time.Now()
+	cutoff := now.Add(-olderThan)
+	var stale []string
+	var young []ObjectInfo
+	err := WalkObjects(ctx, sess, bucket, TempObjectsPrefix, func(obj ObjectInfo) bool {
+		if obj.LastModified.Before(cutoff) {
+			stale = append(stale, obj.Key)
+		} else {
+			young = append(young, obj)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// The TTL is only visible in the tags, so check the remaining objects one by one
+	svc := s3.New(sess)
+	var mu sync.Mutex
+	err = runParallel(ctx, DefaultConcurrency, young, func(ctx context.Context, obj ObjectInfo) error {
+		out, err := svc.GetObjectTaggingWithContext(ctx, &s3.GetObjectTaggingInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(obj.Key),
+		})
+		if err = wrapError(err); errors.Is(err, ErrObjectNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for _, tag := range out.TagSet {
+			if aws.StringValue(tag.Key) != TempExpiresTag {
+				continue
+			}
+			expires, err := time.Parse(time.RFC3339, aws.StringValue(tag.Value))
+			if err == nil && now.After(expires) {
+				mu.Lock()
+				stale = append(stale, obj.Key)
+				mu.Unlock()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return DeleteObjects(ctx, sess, bucket, stale)
+}
+
+// TempObjectsSweep returns a JanitorTask running CleanupTempObjects
+func TempObjectsSweep(olderThan time.Duration) JanitorTask {
+	return func(ctx context.Context, sess *session.Session, bucket string) error {
+		_, err := CleanupTempObjects(ctx, sess, bucket, olderThan)
+		return err
+	}
+}
@@ -0,0 +1,144 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// TempPrefixRoot is the prefix under which NewTempPrefix creates scratch prefixes
+const TempPrefixRoot = "_scratch/"
+
+// TempHeartbeatInterval is how often a live TempPrefix refreshes its heartbeat marker
+const TempHeartbeatInterval = time.Minute
+
+// tempHeartbeatName is the marker object kept up to date inside each scratch prefix
+const tempHeartbeatName = ".heartbeat"
+
+// TempPrefix is throwaway working space in a bucket. Close deletes it; if
+// the process dies first, CleanupStaleTempPrefixes removes it once its
+// heartbeat marker stops being refreshed.
+type TempPrefix struct {
+	Bucket string
+	// Prefix ends with "/"
+	Prefix string
+
+	sess      *session.Session
+	stop      context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewTempPrefix creates a unique scratch prefix in bucket and starts
+// refreshing its heartbeat until Close is called or ctx is done
+func (c *Client) NewTempPrefix(ctx context.Context, bucket string) (*TempPrefix, error) {
+	t := &TempPrefix{
+		Bucket: bucket,
+		Prefix: TempPrefixRoot + newUUID() + "/",
+		sess:   c.sess,
+		done:   make(chan struct{}),
+	}
+	if err := t.beat(ctx); err != nil {
+		return nil, err
+	}
+
+	hbCtx, stop := context.WithCancel(ctx)
+	t.stop = stop
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(TempHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hbCtx.Done():
+				return
+			case <-ticker.C:
+				// A missed beat is retried on the next tick
+				t.beat(hbCtx)
+			}
+		}
+	}()
+	return t, nil
+}
+
+// Key returns the key of name inside the scratch prefix
+func (t *TempPrefix) Key(name string) string {
+	return t.Prefix + strings.TrimPrefix(name, "/")
+}
+
+// Close stops the heartbeat and deletes every object under the prefix.
+// Calling Close again returns the first result.
+func (t *TempPrefix) Close(ctx context.Context) error {
+	t.closeOnce.Do(func() {
+		t.stop()
+		<-t.done
+		_, t.closeErr = DeletePrefix(ctx, t.sess, t.Bucket, t.Prefix)
+	})
+	return t.closeErr
+}
+
+func (t *TempPrefix) beat(ctx context.Context) error {
+	_, err := s3.New(t.sess).PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(t.Bucket),
+		Key:         aws.String(t.Prefix + tempHeartbeatName),
+		Body:        strings.NewReader(time.Now().UTC().Format(time.RFC3339)),
+		ContentType: aws.String("text/plain"),
+	}, internalWrite)
+	return wrapError(err)
+}
+
+// CleanupStaleTempPrefixes deletes the scratch prefixes in bucket whose
+// heartbeat is older than maxAge, or missing, and returns how many were
+// removed. maxAge should be several times TempHeartbeatInterval.
+func CleanupStaleTempPrefixes(ctx context.Context, sess *session.Session, bucket string, maxAge time.Duration) (int, error) {
+	svc := s3.New(sess)
+	var prefixes []string
+	err := svc.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(TempPrefixRoot),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, p := range page.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(p.Prefix))
+		}
+		return true
+	})
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, prefix := range prefixes {
+		head, err := svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(prefix + tempHeartbeatName),
+		})
+		if err = wrapError(err); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			return removed, err
+		}
+		if err == nil && aws.TimeValue(head.LastModified).After(cutoff) {
+			continue
+		}
+		if _, err := DeletePrefix(ctx, sess, bucket, prefix); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// StaleTempPrefixSweep returns a JanitorTask running CleanupStaleTempPrefixes
+func StaleTempPrefixSweep(maxAge time.Duration) JanitorTask {
+	return func(ctx context.Context, sess *session.Session, bucket string) error {
+		_, err := CleanupStaleTempPrefixes(ctx, sess, bucket, maxAge)
+		return err
+	}
+}
@@ -0,0 +1,206 @@
+package s3utils
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// DefaultMaxThrottleDelay caps the wait after a throttled response when
+// ThrottleOptions.MaxDelay is zero
+const DefaultMaxThrottleDelay = time.Minute
+
+// ThrottleEvent describes a throttled S3 response
+type ThrottleEvent struct {
+	Operation  string
+	Bucket     string
+	Key        string
+	Code       string
+	StatusCode int
+	// RetryAfter is the wait asked for by the Retry-After header, zero if
+	// the response had none
+	RetryAfter time.Duration
+	// Delay is how long requests through the client are held back
+	Delay time.Duration
+	// Attempt is the throttled attempt, starting at 1
+	Attempt int
+	// WillRetry is false when the request gives up and returns ErrThrottled
+	WillRetry bool
+}
+
+// ThrottleObserver is called for every throttled response, so batch jobs can
+// slow down their own producers while S3 is shedding load
+type ThrottleObserver func(ThrottleEvent)
+
+// ThrottleOptions configures WithThrottleHandling
+type ThrottleOptions struct {
+	// Observer is notified of throttled responses. It is called from the
+	// request goroutine and should not block.
+	Observer ThrottleObserver
+	// MaxDelay caps every wait, including Retry-After hints. Zero uses DefaultMaxThrottleDelay.
+	MaxDelay time.Duration
+}
+
+// WithThrottleHandling backs off from 503 SlowDown and 429 responses, and
+// from 503 responses with a Retry-After header, using the server's hints.
+// A Retry-After header, in seconds or as an HTTP date, sets the least wait
+// before the retry; without one, the wait grows with jitter from half a
+// second. The wait also holds back every other request made through the
+// client until it has passed, so concurrent workers do not keep hitting a
+// prefix that is being throttled.
+//
+// Other retryable errors use the session's retryer unchanged. Apply the
+// option after any option that sets the session's Retryer or MaxRetries.
+func WithThrottleHandling(opts ThrottleOptions) ClientOption {
+	return func(c *Client) {
+		if opts.MaxDelay <= 0 {
+			opts.MaxDelay = DefaultMaxThrottleDelay
+		}
+		base, ok := c.sess.Config.Retryer.(request.Retryer)
+		if !ok {
+			maxRetries := aws.IntValue(c.sess.Config.MaxRetries)
+			if c.sess.Config.MaxRetries == nil || maxRetries == aws.UseServiceDefaultRetries {
+				maxRetries = client.DefaultRetryerMaxNumRetries
+			}
+			base = client.DefaultRetryer{NumMaxRetries: maxRetries}
+		}
+		t := &throttleRetryer{Retryer: base, opts: opts}
+		c.sess.Config.Retryer = t
+
+		// Signing right after the wait keeps the signature fresh
+		c.sess.Handlers.Sign.PushFrontNamed(request.NamedHandler{
+			Name: "s3utils.ThrottleHold",
+			Fn:   t.wait,
+		})
+		c.sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+			Name: "s3utils.ThrottleGiveUp",
+			Fn: func(r *request.Request) {
+				if r.Error == nil || !isThrottled(r) {
+					return
+				}
+				hint, _ := retryAfter(r.HTTPResponse)
+				t.observe(r, hint, min(hint, opts.MaxDelay), false)
+			},
+		})
+	}
+}
+
+// throttleRetryer replaces the retry delay of throttled responses and keeps
+// the time until which the client holds back requests
+type throttleRetryer struct {
+	request.Retryer
+	opts ThrottleOptions
+
+	mu        sync.Mutex
+	holdUntil time.Time
+}
+
+// RetryRules returns the larger of the Retry-After hint and the jittered
+// backoff for throttled responses, and the base retryer's delay otherwise
+func (t *throttleRetryer) RetryRules(r *request.Request) time.Duration {
+	if !isThrottled(r) {
+		return t.Retryer.RetryRules(r)
+	}
+	delay := JitteredBackoff(client.DefaultRetryerMinThrottleDelay, t.opts.MaxDelay)(r.RetryCount + 1)
+	hint, ok := retryAfter(r.HTTPResponse)
+	if ok && hint > delay {
+		delay = hint
+	}
+	delay = min(delay, t.opts.MaxDelay)
+	t.observe(r, hint, delay, true)
+	return delay
+}
+
+// observe holds back requests for delay and notifies the observer
+func (t *throttleRetryer) observe(r *request.Request, hint, delay time.Duration, willRetry bool) {
+	t.mu.Lock()
+	if until := time.Now().Add(delay); until.After(t.holdUntil) {
+		t.holdUntil = until
+	}
+	t.mu.Unlock()
+
+	if t.opts.Observer == nil {
+		return
+	}
+	event := ThrottleEvent{
+		Operation:  r.Operation.Name,
+		Bucket:     getStringParam(r.Params, "Bucket"),
+		Key:        getStringParam(r.Params, "Key"),
+		RetryAfter: hint,
+		Delay:      delay,
+		Attempt:    r.RetryCount + 1,
+		WillRetry:  willRetry,
+	}
+	if aerr, ok := r.Error.(awserr.Error); ok {
+		event.Code = aerr.Code()
+	}
+	if r.HTTPResponse != nil {
+		event.StatusCode = r.HTTPResponse.StatusCode
+	}
+	t.opts.Observer(event)
+}
+
+// wait delays a request until the client's hold has passed
+func (t *throttleRetryer) wait(r *request.Request) {
+	t.mu.Lock()
+	d := time.Until(t.holdUntil)
+	t.mu.Unlock()
+	if d <= 0 {
+		return
+	}
+	if err := sleepCtx(r.Context(), d); err != nil {
+		r.Error = awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+}
+
+// isThrottled reports whether the response asks the client to slow down.
+// A 503 only counts with a SlowDown code or a Retry-After header, since it
+// also reports an overloaded or broken endpoint. Gateway errors, which the
+// SDK also retries as throttles, are not.
+func isThrottled(r *request.Request) bool {
+	if r.HTTPResponse != nil {
+		switch r.HTTPResponse.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusServiceUnavailable:
+			if r.HTTPResponse.Header.Get("Retry-After") != "" {
+				return true
+			}
+		}
+	}
+	if aerr, ok := r.Error.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "SlowDown", "TooManyRequests":
+			return true
+		}
+	}
+	return request.IsErrorThrottle(r.Error)
+}
+
+// retryAfter parses the Retry-After header of resp, given either as
+// seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
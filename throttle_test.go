@@ -0,0 +1,86 @@
+package s3utils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "5", 5 * time.Second, true},
+		{"zero", "0", 0, true},
+		{"negative", "-1", 0, false},
+		{"garbage", "soon", 0, false},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(resp)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.header, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	t.Run("future date", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", time.Now().Add(30*time.Second).UTC().Format(http.TimeFormat))
+		got, ok := retryAfter(resp)
+		// HTTP dates have a resolution of one second
+		if !ok || got < 28*time.Second || got > 30*time.Second {
+			t.Errorf("retryAfter = %v, %v; want about 30s", got, ok)
+		}
+	})
+	t.Run("no response", func(t *testing.T) {
+		if got, ok := retryAfter(nil); got != 0 || ok {
+			t.Errorf("retryAfter(nil) = %v, %v", got, ok)
+		}
+	})
+}
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		code       string
+		want       bool
+	}{
+		{"SlowDown", http.StatusServiceUnavailable, "", "SlowDown", true},
+		{"429", http.StatusTooManyRequests, "", "", true},
+		{"TooManyRequests code", http.StatusBadRequest, "", "TooManyRequests", true},
+		{"503 with Retry-After", http.StatusServiceUnavailable, "2", "ServiceUnavailable", true},
+		{"bare 503", http.StatusServiceUnavailable, "", "ServiceUnavailable", false},
+		{"500", http.StatusInternalServerError, "", "InternalError", false},
+		{"504", http.StatusGatewayTimeout, "", "", false},
+		{"SDK throttle code", http.StatusBadRequest, "", "RequestLimitExceeded", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &request.Request{HTTPResponse: &http.Response{StatusCode: tt.status, Header: http.Header{}}}
+			if tt.retryAfter != "" {
+				r.HTTPResponse.Header.Set("Retry-After", tt.retryAfter)
+			}
+			if tt.code != "" {
+				r.Error = awserr.New(tt.code, "", nil)
+			}
+			if got := isThrottled(r); got != tt.want {
+				t.Errorf("isThrottled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package s3utils
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Timeouts bounds how long S3 calls made through a Client may take. Zero
+// fields keep the SDK and net/http defaults, which never time out a
+// stalled transfer.
+type Timeouts struct {
+	// Connect limits establishing the TCP connection and the TLS handshake
+	Connect time.Duration
+	// ResponseHeader limits the wait for response headers after the request
+	// body has been sent, catching servers that stop responding
+	ResponseHeader time.Duration
+	// Attempt limits a single HTTP attempt, including sending and receiving
+	// the body. Set it above the time one part or object takes to transfer.
+	// A timed out attempt is retried.
+	Attempt time.Duration
+	// Operation limits a single S3 API call including all of its retries.
+	// For GetObject it also covers reading the body. A multipart transfer is
+	// many calls; bound it as a whole with the context passed to it.
+	Operation time.Duration
+}
+
+// WithTimeouts applies t to every request made through the Client
+func WithTimeouts(t Timeouts) ClientOption {
+	return func(c *Client) {
+		if t.Connect > 0 || t.ResponseHeader > 0 || t.Attempt > 0 {
+			c.sess.Config.HTTPClient = timeoutHTTPClient(c.sess.Config.HTTPClient, t)
+		}
+		if t.Operation > 0 {
+			c.sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+				Name: "s3utils.OperationTimeout",
+				Fn: func(r *request.Request) {
+					ctx, cancel := context.WithTimeout(r.Context(), t.Operation)
+					r.SetContext(ctx)
+					r.Handlers.Complete.PushBack(func(r *request.Request) {
+						switch out := r.Data.(type) {
+						case *s3.GetObjectOutput:
+							// The body is read after the call completes
+							if r.Error == nil && out.Body != nil {
+								out.Body = &cancelOnClose{ReadCloser: out.Body, cancel: cancel}
+								return
+							}
+						case *s3.SelectObjectContentOutput:
+							if r.Error == nil {
+								time.AfterFunc(t.Operation, cancel)
+								return
+							}
+						}
+						cancel()
+					})
+				},
+			})
+		}
+	}
+}
+
+// timeoutHTTPClient returns a copy of base, or of the default client, with
+// the connection and attempt limits of t. The session's client is shared
+// with the session it was copied from, so it is never modified in place.
+func timeoutHTTPClient(base *http.Client, t Timeouts) *http.Client {
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+	var transport *http.Transport
+	switch rt := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = rt.Clone()
+	}
+	// A custom RoundTripper is kept as is; only Attempt applies to it
+	if transport != nil {
+		if t.Connect > 0 {
+			dialer := &net.Dialer{Timeout: t.Connect, KeepAlive: 30 * time.Second}
+			transport.DialContext = dialer.DialContext
+			transport.TLSHandshakeTimeout = t.Connect
+		}
+		if t.ResponseHeader > 0 {
+			transport.ResponseHeaderTimeout = t.ResponseHeader
+		}
+		client.Transport = transport
+	}
+	if t.Attempt > 0 {
+		client.Timeout = t.Attempt
+	}
+	return client
+}
+
+// cancelOnClose releases an operation context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,90 @@
+package s3utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// NameFormat returns the i-th alternative to baseName, for i starting at 1,
+// tried after baseName itself is taken. Every i must give a distinct name.
+type NameFormat func(baseName string, i int) string
+
+// CounterFormat appends "_<i>" before the extension: report_1.pdf,
+// report_2.pdf. It is the default format.
+func CounterFormat(baseName string, i int) string {
+	stem, ext := splitExt(baseName)
+	return fmt.Sprintf("%s_%d%s", stem, i, ext)
+}
+
+// PaddedFormat appends sep and i zero-padded to width digits before the
+// extension, so PaddedFormat("-", 3) gives report-001.pdf, report-002.pdf
+func PaddedFormat(sep string, width int) NameFormat {
+	return func(baseName string, i int) string {
+		stem, ext := splitExt(baseName)
+		return fmt.Sprintf("%s%s%0*d%s", stem, sep, width, i, ext)
+	}
+}
+
+// TimestampFormat appends "_" and the current UTC time formatted with layout
+// before the extension, for example report_20240131T120000.pdf with the
+// layout "20060102T150405". From the second alternative on a counter is
+// added as well, since two names may be generated within one tick of layout.
+func TimestampFormat(layout string) NameFormat {
+	return func(baseName string, i int) string {
+		stem, ext := splitExt(baseName)
+		ts := time.Now().UTC().Format(layout)
+		if i == 1 {
+			return fmt.Sprintf("%s_%s%s", stem, ts, ext)
+		}
+		return fmt.Sprintf("%s_%s_%d%s", stem, ts, i-1, ext)
+	}
+}
+
+func splitExt(baseName string) (string, string) {
+	ext := filepath.Ext(baseName)
+	return baseName[:len(baseName)-len(ext)], ext
+}
+
+// NamesExhaustedError is returned when every candidate name allowed by the
+// attempt limit is taken
+type NamesExhaustedError struct {
+	Folder   string
+	BaseName string
+	Attempts int
+}
+
+func (e *NamesExhaustedError) Error() string {
+	return fmt.Sprintf("s3utils: no free name for %s after %d attempts", JoinKey(e.Folder, e.BaseName), e.Attempts)
+}
+
+// UniqueNameOptions configures GenerateUniqueFileNameWithOptions
+type UniqueNameOptions struct {
+	// Format builds the alternatives to the base name. Nil uses CounterFormat.
+	Format NameFormat
+	// MaxAttempts bounds the number of names probed, including the base
+	// name. Zero probes until a free name is found.
+	MaxAttempts int
+}
+
+// candidate returns the i-th name to try, baseName itself for 0
+func (o UniqueNameOptions) candidate(baseName string, i int) string {
+	if i == 0 {
+		return baseName
+	}
+	if o.Format == nil {
+		return CounterFormat(baseName, i)
+	}
+	return o.Format(baseName, i)
+}
+
+// GenerateUniqueFileNameWithOptions generates a unique file name like
+// GenerateUniqueFileName with a configurable suffix format and attempt
+// limit. Exhausting the limit returns a *NamesExhaustedError.
+func GenerateUniqueFileNameWithOptions(sess *session.Session, bucket, folder, baseName string, opts UniqueNameOptions) (string, error) {
+	return generateUniqueFileName(folder, baseName, opts, func(key string) (bool, error) {
+		return CheckS3FileExists(sess, bucket, key)
+	})
+}
@@ -0,0 +1,55 @@
+package s3utils
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// UploadFS uploads every regular file in fsys to bucket under prefix,
+// keeping its path relative to the root of fsys, and returns the keys in
+// walk order. Any fs.FS works, including embed.FS and os.DirFS. opts apply
+// to every file; Content-Type is detected per file unless an option sets it.
+func UploadFS(ctx context.Context, sess *session.Session, fsys fs.FS, bucket, prefix string, opts ...UploadOption) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject bad names before any request rather than part way through the batch
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = JoinKey(prefix, name)
+		if err := ValidateKey(keys[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	idx := make([]int, len(names))
+	for i := range idx {
+		idx[i] = i
+	}
+	err = runParallel(ctx, DefaultConcurrency, idx, func(ctx context.Context, i int) error {
+		file, err := fsys.Open(names[i])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = newUploadConfig(bucket, keys[i], file, opts).upload(ctx, sess)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,208 @@
+package s3utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrInvalidName is matched by every ValidationError
+var ErrInvalidName = errors.New("s3utils: invalid bucket or key name")
+
+// ValidationError describes a bucket name or key rejected before it was sent
+type ValidationError struct {
+	// Field is "bucket" or "key"
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("s3utils: invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// Unwrap returns ErrInvalidName
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidName
+}
+
+// MaxKeyLength is the longest key S3 accepts, in UTF-8 bytes
+const MaxKeyLength = 1024
+
+// NameRules selects how strictly bucket names and keys are checked. The zero
+// value enforces the rules S3 itself applies.
+type NameRules struct {
+	// DNSCompatible rejects bucket names containing dots, which break TLS
+	// certificate matching for virtual-hosted-style requests
+	DNSCompatible bool
+	// SafeKeys rejects the key characters S3 recommends avoiding, such as
+	// backslash, braces, "%", "#" and ASCII control characters
+	SafeKeys bool
+	// MaxKeyLength lowers the key length limit. Zero uses MaxKeyLength.
+	MaxKeyLength int
+}
+
+// DefaultNameRules are the rules applied by ValidateBucketName, ValidateKey
+// and sessions created by NewAWSSession
+var DefaultNameRules = NameRules{}
+
+// ValidateBucketName checks name against DefaultNameRules
+func ValidateBucketName(name string) error {
+	return DefaultNameRules.ValidateBucketName(name)
+}
+
+// ValidateNewBucketName checks the name of a bucket to be created against
+// DefaultNameRules
+func ValidateNewBucketName(name string) error {
+	return DefaultNameRules.ValidateNewBucketName(name)
+}
+
+// ValidateKey checks key against DefaultNameRules
+func ValidateKey(key string) error {
+	return DefaultNameRules.ValidateKey(key)
+}
+
+// ValidateBucketName checks name against the S3 bucket naming rules.
+// Access point and Object Lambda ARNs are accepted unchanged, and so are the
+// reserved prefixes and suffixes that S3 gives names of its own, such as
+// access point aliases and directory buckets.
+func (r NameRules) ValidateBucketName(name string) error {
+	return r.validateBucketName(name, false)
+}
+
+// ValidateNewBucketName checks the name of a bucket to be created: on top of
+// ValidateBucketName, prefixes and suffixes reserved by S3 are rejected.
+func (r NameRules) ValidateNewBucketName(name string) error {
+	return r.validateBucketName(name, true)
+}
+
+func (r NameRules) validateBucketName(name string, create bool) error {
+	if strings.HasPrefix(name, "arn:") {
+		return nil
+	}
+	invalid := func(format string, args ...interface{}) error {
+		return &ValidationError{Field: "bucket", Value: name, Reason: fmt.Sprintf(format, args...)}
+	}
+	if len(name) < 3 || len(name) > 63 {
+		return invalid("must be 3 to 63 characters long, got %d", len(name))
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-':
+		case c == '.':
+			if r.DNSCompatible {
+				return invalid("dots are not allowed in DNS-compatible names")
+			}
+		case c >= 'A' && c <= 'Z':
+			return invalid("uppercase letter %q at offset %d is not allowed", c, i)
+		default:
+			return invalid("character %q at offset %d is not allowed; use lowercase letters, digits, dots and hyphens", c, i)
+		}
+	}
+	if !isAlphanumeric(name[0]) || !isAlphanumeric(name[len(name)-1]) {
+		return invalid("must begin and end with a letter or digit")
+	}
+	if strings.Contains(name, "..") {
+		return invalid("must not contain two adjacent dots")
+	}
+	if net.ParseIP(name) != nil {
+		return invalid("must not be formatted as an IP address")
+	}
+	if !create {
+		return nil
+	}
+	for _, p := range []string{"xn--", "sthree-", "amzn-s3-demo-"} {
+		if strings.HasPrefix(name, p) {
+			return invalid("the prefix %q is reserved", p)
+		}
+	}
+	for _, s := range []string{"-s3alias", "--ol-s3", ".mrap", "--x-s3"} {
+		if strings.HasSuffix(name, s) {
+			return invalid("the suffix %q is reserved", s)
+		}
+	}
+	return nil
+}
+
+// ValidateKey checks key against the S3 object key rules. Characters that
+// cannot be represented in XML 1.0 are always rejected because they make
+// the object impossible to list.
+func (r NameRules) ValidateKey(key string) error {
+	invalid := func(format string, args ...interface{}) error {
+		return &ValidationError{Field: "key", Value: key, Reason: fmt.Sprintf(format, args...)}
+	}
+	if key == "" {
+		return invalid("must not be empty")
+	}
+	limit := r.MaxKeyLength
+	if limit <= 0 || limit > MaxKeyLength {
+		limit = MaxKeyLength
+	}
+	if len(key) > limit {
+		return invalid("is %d bytes long, the limit is %d", len(key), limit)
+	}
+	if !utf8.ValidString(key) {
+		return invalid("is not valid UTF-8")
+	}
+	for i, c := range key {
+		if (c < 0x20 && c != '\t' && c != '\n' && c != '\r') || c == 0xfffe || c == 0xffff {
+			return invalid("character %U at offset %d cannot be represented in XML", c, i)
+		}
+		if r.SafeKeys && isUnsafeKeyRune(c) {
+			return invalid("character %q at offset %d should be avoided in keys", c, i)
+		}
+	}
+	return nil
+}
+
+// isUnsafeKeyRune reports whether S3 recommends avoiding c in keys
+func isUnsafeKeyRune(c rune) bool {
+	return c < 0x20 || c == 0x7f || strings.ContainsRune(`\{}^%`+"`"+`[]"<>~#|`, c)
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
+
+// validateNamesHandlerName is the name of the handler installed by nameValidationHandler
+const validateNamesHandlerName = "s3utils.ValidateNames"
+
+// nameValidationHandler rejects S3 requests whose Bucket or Key
+// parameters break rules before anything is sent. Reserved bucket names are
+// only rejected for CreateBucket.
+func nameValidationHandler(rules NameRules) request.NamedHandler {
+	return request.NamedHandler{
+		Name: validateNamesHandlerName,
+		Fn: func(r *request.Request) {
+			if r.ClientInfo.ServiceName != s3.ServiceName {
+				return
+			}
+			if bucket := getStringParam(r.Params, "Bucket"); bucket != "" {
+				create := r.Operation != nil && r.Operation.Name == "CreateBucket"
+				if err := rules.validateBucketName(bucket, create); err != nil {
+					r.Error = err
+					return
+				}
+			}
+			if key := getStringParam(r.Params, "Key"); key != "" {
+				if err := rules.ValidateKey(key); err != nil {
+					r.Error = err
+				}
+			}
+		},
+	}
+}
+
+// WithNameRules validates the bucket name and key of every request made
+// through the Client against rules, replacing the default checks
+func WithNameRules(rules NameRules) ClientOption {
+	return func(c *Client) {
+		c.sess.Handlers.Validate.RemoveByName(validateNamesHandlerName)
+		c.sess.Handlers.Validate.PushFrontNamed(nameValidationHandler(rules))
+	}
+}
@@ -0,0 +1,90 @@
+package s3utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateBucketName(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  NameRules
+		bucket string
+		ok     bool
+		// okNew is the result of ValidateNewBucketName
+		okNew bool
+	}{
+		{"simple", NameRules{}, "my-bucket", true, true},
+		{"dots", NameRules{}, "my.bucket", true, true},
+		{"dots DNS-compatible", NameRules{DNSCompatible: true}, "my.bucket", false, false},
+		{"minimum length", NameRules{}, "abc", true, true},
+		{"too short", NameRules{}, "ab", false, false},
+		{"maximum length", NameRules{}, strings.Repeat("a", 63), true, true},
+		{"too long", NameRules{}, strings.Repeat("a", 64), false, false},
+		{"uppercase", NameRules{}, "MyBucket", false, false},
+		{"underscore", NameRules{}, "my_bucket", false, false},
+		{"leading hyphen", NameRules{}, "-bucket", false, false},
+		{"trailing dot", NameRules{}, "bucket.", false, false},
+		{"adjacent dots", NameRules{}, "my..bucket", false, false},
+		{"IP address", NameRules{}, "192.168.5.4", false, false},
+		{"access point ARN", NameRules{}, "arn:aws:s3:us-east-1:123456789012:accesspoint/ap", true, true},
+		{"reserved prefix", NameRules{}, "xn--bucket", true, false},
+		{"reserved sthree prefix", NameRules{}, "sthree-bucket", true, false},
+		{"access point alias", NameRules{}, "ap-abc123-s3alias", true, false},
+		{"Object Lambda alias", NameRules{}, "ap-abc123--ol-s3", true, false},
+		{"directory bucket", NameRules{}, "bucket--usw2-az1--x-s3", true, false},
+		{"multi-region access point", NameRules{}, "bucket.mrap", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.ValidateBucketName(tt.bucket)
+			if (err == nil) != tt.ok {
+				t.Errorf("ValidateBucketName(%q) = %v, want ok %v", tt.bucket, err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidName) {
+				t.Errorf("ValidateBucketName(%q) = %v, not ErrInvalidName", tt.bucket, err)
+			}
+			if err := tt.rules.ValidateNewBucketName(tt.bucket); (err == nil) != tt.okNew {
+				t.Errorf("ValidateNewBucketName(%q) = %v, want ok %v", tt.bucket, err, tt.okNew)
+			}
+		})
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules NameRules
+		key   string
+		ok    bool
+	}{
+		{"simple", NameRules{}, "dir/file.txt", true},
+		{"empty", NameRules{}, "", false},
+		{"unicode", NameRules{}, "dir/résumé.pdf", true},
+		{"maximum length", NameRules{}, strings.Repeat("a", MaxKeyLength), true},
+		{"too long", NameRules{}, strings.Repeat("a", MaxKeyLength+1), false},
+		{"lowered limit", NameRules{MaxKeyLength: 8}, "abcdefghi", false},
+		{"limit above maximum", NameRules{MaxKeyLength: 2 * MaxKeyLength}, strings.Repeat("a", MaxKeyLength+1), false},
+		{"invalid UTF-8", NameRules{}, "dir/\xff", false},
+		{"tab and newline", NameRules{}, "a\tb\nc", true},
+		{"control character", NameRules{}, "a\x01b", false},
+		{"noncharacter", NameRules{}, "a\uffffb", false},
+		{"unsafe allowed by default", NameRules{}, "a#b%c", true},
+		{"unsafe with SafeKeys", NameRules{SafeKeys: true}, "a#b", false},
+		{"backslash with SafeKeys", NameRules{SafeKeys: true}, `a\b`, false},
+		{"safe with SafeKeys", NameRules{SafeKeys: true}, "dir/a-b_c.d(1)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.ValidateKey(tt.key)
+			if (err == nil) != tt.ok {
+				t.Errorf("ValidateKey(%q) = %v, want ok %v", tt.key, err, tt.ok)
+			}
+			var verr *ValidationError
+			if err != nil && (!errors.As(err, &verr) || verr.Field != "key") {
+				t.Errorf("ValidateKey(%q) = %v, not a key ValidationError", tt.key, err)
+			}
+		})
+	}
+}
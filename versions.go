@@ -0,0 +1,126 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectVersion describes one version or delete marker of an object
+type ObjectVersion struct {
+	Key            string
+	VersionID      string
+	IsLatest       bool
+	IsDeleteMarker bool
+	Size           int64
+	ETag           string
+	LastModified   time.Time
+}
+
+// CheckS3FileVersionExists checks if a specific version of a file exists in the S3 bucket.
+// A missing bucket is reported as ErrBucketNotFound.
+func CheckS3FileVersionExists(sess *session.Session, bucket, key, versionID string) (bool, error) {
+	ctx := context.Background()
+	svc := s3.New(sess)
+	exists, err := objectExists(ctx, svc, bucket, key, versionID)
+	if err != nil || exists {
+		return exists, err
+	}
+	if err := missingBucketError(ctx, svc, bucket); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// objectExists heads bucket/key, or the given version of it, and reports
+// whether it exists. HEAD cannot tell a missing bucket from a missing key,
+// so both are reported as false.
+func objectExists(ctx context.Context, svc *s3.S3, bucket, key, versionID string) (bool, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	_, err := svc.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		err = wrapError(err)
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// WithVersionID downloads a specific object version instead of the latest one
+func WithVersionID(versionID string) DownloadOption {
+	return WithDownloadInput(func(in *s3.GetObjectInput) {
+		in.VersionId = aws.String(versionID)
+	})
+}
+
+// ListObjectVersions lists all versions and delete markers under prefix
+func ListObjectVersions(ctx context.Context, sess *session.Session, bucket, prefix string) ([]ObjectVersion, error) {
+	svc := s3.New(sess)
+	var versions []ObjectVersion
+	err := svc.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, v := range page.Versions {
+			versions = append(versions, ObjectVersion{
+				Key:          aws.StringValue(v.Key),
+				VersionID:    aws.StringValue(v.VersionId),
+				IsLatest:     aws.BoolValue(v.IsLatest),
+				Size:         aws.Int64Value(v.Size),
+				ETag:         aws.StringValue(v.ETag),
+				LastModified: aws.TimeValue(v.LastModified),
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			versions = append(versions, ObjectVersion{
+				Key:            aws.StringValue(m.Key),
+				VersionID:      aws.StringValue(m.VersionId),
+				IsLatest:       aws.BoolValue(m.IsLatest),
+				IsDeleteMarker: true,
+				LastModified:   aws.TimeValue(m.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return versions, nil
+}
+
+// RestoreVersion makes versionID the latest version of key by copying it onto itself
+func RestoreVersion(ctx context.Context, sess *session.Session, bucket, key, versionID string) (string, error) {
+	svc := s3.New(sess)
+	out, err := svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(copySource(bucket, key) + "?versionId=" + versionID),
+	})
+	if err != nil {
+		return "", wrapError(err)
+	}
+	return aws.StringValue(out.VersionId), nil
+}
+
+// DeleteVersion permanently deletes a single version or delete marker of key
+func DeleteVersion(ctx context.Context, sess *session.Session, bucket, key, versionID string) error {
+	svc := s3.New(sess)
+	_, err := svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	})
+	return wrapError(err)
+}
@@ -0,0 +1,120 @@
+package s3utils
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// WebDownloadOptions selects the headers applied to files that end users download directly
+type WebDownloadOptions struct {
+	// Disposition is "attachment" to force a download or "inline" to let the browser display the file
+	Disposition string
+	// CacheControl is the Cache-Control header value
+	CacheControl string
+	// DefaultContentType is used when the key extension has no known MIME type
+	DefaultContentType string
+}
+
+// WebDownloadDefaults returns options for private, downloadable files
+func WebDownloadDefaults() WebDownloadOptions {
+	return WebDownloadOptions{
+		Disposition:        "attachment",
+		CacheControl:       "private, max-age=3600",
+		DefaultContentType: "application/octet-stream",
+	}
+}
+
+// headers returns the Content-Disposition, Content-Type and Cache-Control values for key
+func (o WebDownloadOptions) headers(key string) (disposition, contentType, cacheControl string) {
+	name := path.Base(key)
+	if o.Disposition != "" {
+		disposition = contentDisposition(o.Disposition, name)
+	}
+	contentType = mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = o.DefaultContentType
+	}
+	return disposition, contentType, o.CacheControl
+}
+
+// contentDisposition builds a Content-Disposition value with an ASCII
+// filename fallback and an RFC 5987 filename* for the exact name
+func contentDisposition(disposition, name string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	return disposition + `; filename="` + fallback + `"; filename*=UTF-8''` + url.PathEscape(name)
+}
+
+// WithWebDownload sets the download headers of o on the uploaded object.
+// Its Content-Type replaces the one detected from the key and body, but
+// headers already set by earlier options are kept.
+func WithWebDownload(o WebDownloadOptions) UploadOption {
+	return func(c *uploadConfig) {
+		in := c.input
+		disposition, contentType, cacheControl := o.headers(aws.StringValue(in.Key))
+		if in.ContentType == c.detectedContentType && contentType != "" {
+			in.ContentType = aws.String(contentType)
+			c.detectedContentType = nil
+		}
+		setIfEmpty(&in.ContentDisposition, disposition)
+		setIfEmpty(&in.CacheControl, cacheControl)
+	}
+}
+
+// webDownloadDefaultsHandlerName is the name of the handler installed by WithWebDownloadDefaults
+const webDownloadDefaultsHandlerName = "s3utils.WebDownloadDefaults"
+
+// internalWrite marks a write of an object the package keeps for its own
+// use, such as a counter, receipt or marker, so the session-wide download
+// headers of WithWebDownloadDefaults are not applied to it
+func internalWrite(r *request.Request) {
+	r.Handlers.Build.RemoveByName(webDownloadDefaultsHandlerName)
+}
+
+// WithWebDownloadDefaults applies o to every object written through the
+// Client, as WithWebDownload does for a single upload. Objects the package
+// writes for its own bookkeeping are left alone.
+func WithWebDownloadDefaults(o WebDownloadOptions) ClientOption {
+	return func(c *Client) {
+		c.sess.Handlers.Build.PushFrontNamed(request.NamedHandler{
+			Name: webDownloadDefaultsHandlerName,
+			Fn: func(r *request.Request) {
+				if r.ClientInfo.ServiceName != s3.ServiceName {
+					return
+				}
+				switch r.Operation.Name {
+				case "PutObject", "CreateMultipartUpload":
+				default:
+					return
+				}
+				disposition, contentType, cacheControl := o.headers(getStringParam(r.Params, "Key"))
+				if disposition != "" {
+					setStringParam(r.Params, "ContentDisposition", disposition)
+				}
+				if contentType != "" {
+					setStringParam(r.Params, "ContentType", contentType)
+				}
+				if cacheControl != "" {
+					setStringParam(r.Params, "CacheControl", cacheControl)
+				}
+			},
+		})
+	}
+}
+
+// setIfEmpty sets *p to value unless it is already set or value is empty
+func setIfEmpty(p **string, value string) {
+	if *p == nil && value != "" {
+		*p = aws.String(value)
+	}
+}